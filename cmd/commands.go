@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/app"
+)
+
+const usage = `usage:
+  main [-config path] migrate up              apply all pending migrations
+  main [-config path] migrate down [n]        roll back the last n migrations (default 1)
+  main [-config path] migrate status          list migrations and whether they are applied
+  main [-config path] role <username> <role>  set the role of a user, "user" or "admin"`
+
+func runCommand(application *app.App, args []string) error {
+	switch {
+	case args[0] == "migrate" && len(args) > 1:
+		return runMigrate(application, args[1:])
+	case args[0] == "role" && len(args) == 3:
+		return application.SetUserRole(context.Background(), args[1], args[2])
+	default:
+		return fmt.Errorf("unknown command\n%s", usage)
+	}
+}
+
+func runMigrate(application *app.App, args []string) error {
+	migrator, err := application.Migrator()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %06d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("rolled back %06d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%06d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], usage)
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"flag"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -16,9 +16,20 @@ func main() {
 	cfg := config.MustLoad()
 	log := setupLogger(cfg.Env)
 	log.Info("starting application", slog.String("env", cfg.Env))
-	application := app.New(log, cfg.Port)
-	fmt.Print(cfg.Storagepath)
-	go application.Run(cfg.Storagepath, secret, cfg.TokenTTL)
+	log.Info("using storage", slog.String("driver", cfg.Storage.Driver))
+	application := app.New(log, cfg)
+	if args := flag.Args(); len(args) > 0 {
+		if err := runCommand(application, args); err != nil {
+			log.Error("command failed", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+	go func() {
+		if err := application.Run(secret); err != nil {
+			log.Error("application stopped with error", slog.String("error", err.Error()))
+		}
+	}()
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	sign := <-stop
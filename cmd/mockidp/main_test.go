@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/splashk1e/avito-shop/internal/handlers"
+	"github.com/splashk1e/avito-shop/internal/lib/jwt"
+	"github.com/splashk1e/avito-shop/internal/services"
+	"github.com/splashk1e/avito-shop/internal/storage/memory"
+)
+
+const (
+	testClientId     = "avito-shop"
+	testClientSecret = "avito-shop-secret"
+	testRedirectURL  = "http://shop.test/api/auth/oidc/callback"
+	testWelcomeGrant = 1000
+)
+
+// newTestShop starts the identity provider and returns the shop router
+// using it for single sign-on.
+func newTestShop(t *testing.T) http.Handler {
+	t.Helper()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// the issuer is the address of the server, known once it listens
+	idp := httptest.NewUnstartedServer(nil)
+	p, err := newProvider(log, "http://"+idp.Listener.Addr().String(), testClientId, testClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.Config.Handler = p.handler()
+	idp.Start()
+	t.Cleanup(idp.Close)
+
+	gin.SetMode(gin.TestMode)
+	store := memory.New()
+	keys, err := jwt.NewHMACKeySet("test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := services.NewAuthService(log, store, store, store, store, 15*time.Minute, time.Hour, time.Hour, keys, testWelcomeGrant,
+		services.RegistrationPolicy{})
+	oidc, err := services.NewOIDCService(context.Background(), log, auth, store, services.OIDCConfig{
+		Issuer:        idp.URL,
+		ClientID:      testClientId,
+		ClientSecret:  testClientSecret,
+		RedirectURL:   testRedirectURL,
+		UsernameClaim: "preferred_username",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlers.NewHandler(auth,
+		services.NewTransactionsService(store, store, store, log),
+		services.NewCatalogService(store, store, log),
+		services.NewIdempotencyService(store, log),
+		services.NewLoginGuard(memory.NewAttemptStore(), services.LoginThrottlePolicy{}, log),
+		services.NewAPIKeyService(store, store, log),
+		oidc, false, log)
+	return handler.InitRoutes()
+}
+
+// login goes through single sign-on as username and returns the access token.
+func login(t *testing.T, shop http.Handler, username string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	shop.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: %d %s", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+
+	authorize, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authorize.Query()
+	query.Set("login_hint", username)
+	authorize.RawQuery = query.Encode()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authorize.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: %d", resp.StatusCode)
+	}
+
+	callback := httptest.NewRequest(http.MethodGet, resp.Header.Get("Location"), nil)
+	for _, cookie := range cookies {
+		callback.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	shop.ServeHTTP(rec, callback)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback: %d %s", rec.Code, rec.Body)
+	}
+	var tokens struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &tokens); err != nil || tokens.Token == "" {
+		t.Fatalf("callback body %s: %v", rec.Body, err)
+	}
+	return tokens.Token
+}
+
+func request(t *testing.T, shop http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	shop.ServeHTTP(rec, req)
+	return rec
+}
+
+func coins(t *testing.T, shop http.Handler, token string) int {
+	t.Helper()
+	rec := request(t, shop, http.MethodGet, "/api/info", token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("info: %d %s", rec.Code, rec.Body)
+	}
+	var info struct {
+		Coins int `json:"coins"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	return info.Coins
+}
+
+func TestSingleSignOn(t *testing.T) {
+	shop := newTestShop(t)
+
+	token := login(t, shop, "alice")
+	if got := coins(t, shop, token); got != testWelcomeGrant {
+		t.Fatalf("new user has %d coins, want %d", got, testWelcomeGrant)
+	}
+	if rec := request(t, shop, http.MethodGet, "/api/buy/pen", token); rec.Code != http.StatusOK {
+		t.Fatalf("buy: %d %s", rec.Code, rec.Body)
+	}
+	spent := coins(t, shop, token)
+
+	// the second login finds the user linked to the identity
+	if got := coins(t, shop, login(t, shop, "alice")); got != spent {
+		t.Errorf("second login has %d coins, want %d", got, spent)
+	}
+	if got := coins(t, shop, login(t, shop, "bob")); got != testWelcomeGrant {
+		t.Errorf("another identity has %d coins, want %d", got, testWelcomeGrant)
+	}
+}
+
+func TestSingleSignOnRejectsForeignState(t *testing.T) {
+	shop := newTestShop(t)
+	rec := httptest.NewRecorder()
+	shop.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+	callback := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?state=forged&code=x", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	shop.ServeHTTP(rec, callback)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("forged state: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestSingleSignOnHidesProviderErrors(t *testing.T) {
+	shop := newTestShop(t)
+	for reason, detail := range map[string]string{
+		"access_denied":           "the login was denied",
+		"<b>call +1 555 0100</b>": "the provider returned an unknown error",
+	} {
+		rec := httptest.NewRecorder()
+		shop.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+		cookies := rec.Result().Cookies()
+		state, _, _ := strings.Cut(cookies[0].Value, ".")
+		callback := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+url.Values{"state": {state}, "error": {reason}}.Encode(), nil)
+		callback.AddCookie(cookies[0])
+		rec = httptest.NewRecorder()
+		shop.ServeHTTP(rec, callback)
+		var body struct {
+			Code    string `json:"code"`
+			Details string `json:"details"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusUnauthorized || body.Code != "sso_failed" || body.Details != detail {
+			t.Errorf("error %q: %d %s", reason, rec.Code, rec.Body)
+		}
+	}
+}
@@ -2,35 +2,159 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
-	"time"
 
+	"github.com/splashk1e/avito-shop/internal/config"
 	"github.com/splashk1e/avito-shop/internal/handlers"
+	"github.com/splashk1e/avito-shop/internal/models"
 	"github.com/splashk1e/avito-shop/internal/server"
 	"github.com/splashk1e/avito-shop/internal/services"
-	"github.com/splashk1e/avito-shop/internal/storage/postgres"
+	"github.com/splashk1e/avito-shop/internal/storage/memory"
+	"github.com/splashk1e/avito-shop/internal/storage/migrate"
 )
 
 type App struct {
 	log    *slog.Logger
-	port   string
+	cfg    *config.Config
 	server *server.Server
 }
 
-func New(log *slog.Logger, port string) *App {
+func New(log *slog.Logger, cfg *config.Config) *App {
 	return &App{
 		log:    log,
-		port:   port,
+		cfg:    cfg,
 		server: new(server.Server),
 	}
 }
-func (a *App) Run(storagePath, secret string, tokenTTL time.Duration) error {
-	storage := postgres.New(context.Background(), storagePath)
-	authService := services.NewAuthService(a.log, storage, storage, tokenTTL, secret)
-	transacService := services.NewTransactionsService(storage, storage, a.log)
-	handlers := handlers.NewHandler(authService, transacService)
+func (a *App) Run(secret string) error {
+	storage, err := newStorage(context.Background(), a.cfg.Storage)
+	if err != nil {
+		return err
+	}
+	if a.cfg.Storage.MigrateOnStart {
+		if err := a.migrate(context.Background(), storage); err != nil {
+			return err
+		}
+	}
+	keys, err := newKeySet(a.cfg.JWT, secret)
+	if err != nil {
+		return err
+	}
+	registration, err := newRegistrationPolicy(a.cfg.Registration)
+	if err != nil {
+		return err
+	}
+	authService := services.NewAuthService(a.log, storage, storage, storage, storage, a.cfg.TokenTTL, a.cfg.RefreshTokenTTL, a.cfg.PasswordResetTTL, keys, a.cfg.WelcomeGrant, registration)
+	loginGuard, err := newLoginGuard(a.cfg.LoginThrottle, a.log)
+	if err != nil {
+		return err
+	}
+	transacService := services.NewTransactionsService(storage, storage, storage, a.log)
+	catalogService := services.NewCatalogService(storage, storage, a.log)
+	idempotencyService := services.NewIdempotencyService(storage, a.log)
+	apiKeyService := services.NewAPIKeyService(storage, storage, a.log)
+	oidcService, err := a.newOIDCService(authService, storage)
+	if err != nil {
+		return err
+	}
+	handlers := handlers.NewHandler(authService, transacService, catalogService, idempotencyService, loginGuard, apiKeyService, oidcService, a.cfg.LegacyAuthorizeHeader, a.log)
+	router := handlers.InitRoutes()
+	if err := router.SetTrustedProxies(a.cfg.TrustedProxies); err != nil {
+		return err
+	}
+
+	return a.server.Run(a.cfg.Port, a.cfg.Timeout, router)
+}
+
+const (
+	registrationAuto     = "auto"
+	registrationExplicit = "explicit"
+)
+
+func newRegistrationPolicy(cfg config.Registration) (services.RegistrationPolicy, error) {
+	switch cfg.Mode {
+	case registrationAuto, registrationExplicit:
+	default:
+		return services.RegistrationPolicy{}, fmt.Errorf("unknown registration mode %q", cfg.Mode)
+	}
+	return services.RegistrationPolicy{
+		AutoRegister:      cfg.Mode == registrationAuto,
+		MinPasswordLength: cfg.MinPasswordLength,
+	}, nil
+}
 
-	return a.server.Run(a.port, handlers.InitRoutes())
+func newLoginGuard(cfg config.LoginThrottle, log *slog.Logger) (*services.LoginGuard, error) {
+	var store services.LoginAttemptStore
+	switch cfg.Store {
+	case driverMemory:
+		store = memory.NewAttemptStore()
+	default:
+		return nil, fmt.Errorf("unknown login attempt store %q", cfg.Store)
+	}
+	return services.NewLoginGuard(store, services.LoginThrottlePolicy{
+		UsernameAttempts: cfg.UsernameAttempts,
+		IPAttempts:       cfg.IPAttempts,
+		BaseDelay:        cfg.BaseDelay,
+		MaxDelay:         cfg.MaxDelay,
+		Window:           cfg.Window,
+	}, log), nil
+}
+
+// newOIDCService returns nil when no issuer is configured.
+func (a *App) newOIDCService(auth *services.AuthService, identities services.IdentityStore) (*services.OIDCService, error) {
+	cfg := a.cfg.OIDC
+	if cfg.Issuer == "" {
+		return nil, nil
+	}
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc client_id and redirect_url are required")
+	}
+	return services.NewOIDCService(context.Background(), a.log, auth, identities, services.OIDCConfig{
+		Issuer:        cfg.Issuer,
+		ClientID:      cfg.ClientID,
+		ClientSecret:  cfg.ClientSecret,
+		RedirectURL:   cfg.RedirectURL,
+		UsernameClaim: cfg.UsernameClaim,
+		Scopes:        cfg.Scopes,
+	})
+}
+
+// Migrator returns the schema migrator of the configured storage driver.
+func (a *App) Migrator() (*migrate.Migrator, error) {
+	storage, err := newStorage(context.Background(), a.cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return migrator(storage)
+}
+
+// SetUserRole grants role to an existing user, it is how the first admin is created.
+func (a *App) SetUserRole(ctx context.Context, username, role string) error {
+	if role != models.RoleUser && role != models.RoleAdmin {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	storage, err := newStorage(ctx, a.cfg.Storage)
+	if err != nil {
+		return err
+	}
+	return storage.SetUserRole(ctx, username, role)
+}
+
+func (a *App) migrate(ctx context.Context, storage Storage) error {
+	m, err := migrator(storage)
+	if errors.Is(err, migrate.ErrNoMigrations) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up(ctx)
+	for _, migration := range applied {
+		a.log.Info("applied migration", slog.Int("version", migration.Version), slog.String("name", migration.Name))
+	}
+	return err
 }
 
 func (a *App) Stop() {
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"errors"
+
+	"github.com/splashk1e/avito-shop/internal/config"
+	"github.com/splashk1e/avito-shop/internal/lib/jwt"
+)
+
+// newKeySet loads the configured token signing keys, falling back to an
+// HS256 key set built from secret when none are configured.
+func newKeySet(cfg config.JWT, secret string) (*jwt.KeySet, error) {
+	if len(cfg.Keys) == 0 {
+		if secret == "" {
+			return nil, errors.New("SECRET must be set when no jwt keys are configured")
+		}
+		return jwt.NewHMACKeySet(secret)
+	}
+	keys := make([]*jwt.Key, 0, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		key, err := jwt.LoadKey(k.Id, k.Algorithm, k.PrivateKey, k.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return jwt.NewKeySet(cfg.SigningKey, keys...)
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/splashk1e/avito-shop/internal/config"
+	"github.com/splashk1e/avito-shop/internal/services"
+	"github.com/splashk1e/avito-shop/internal/storage/memory"
+	"github.com/splashk1e/avito-shop/internal/storage/migrate"
+	"github.com/splashk1e/avito-shop/internal/storage/postgres"
+	"github.com/splashk1e/avito-shop/internal/storage/sqlite"
+)
+
+// Storage is everything the services need from a storage backend.
+type Storage interface {
+	services.UserSaver
+	services.UserProvider
+	services.TransactionSaver
+	services.TransactionProvider
+	services.CatalogProvider
+	services.CatalogSaver
+	services.IdempotencyKeyStore
+	services.SessionStore
+	services.PasswordResetStore
+	services.IdentityStore
+	services.APIKeyStore
+}
+
+const (
+	driverPostgres = "postgres"
+	driverSQLite   = "sqlite"
+	driverMemory   = "memory"
+)
+
+func newStorage(ctx context.Context, cfg config.Storage) (Storage, error) {
+	switch cfg.Driver {
+	case driverPostgres:
+		return postgres.New(ctx, cfg.Path), nil
+	case driverSQLite:
+		return sqlite.New(cfg.Path), nil
+	case driverMemory:
+		return memory.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+type migratable interface {
+	Migrator() *migrate.Migrator
+}
+
+func migrator(storage Storage) (*migrate.Migrator, error) {
+	m, ok := storage.(migratable)
+	if !ok {
+		return nil, migrate.ErrNoMigrations
+	}
+	return m.Migrator(), nil
+}
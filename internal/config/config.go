@@ -9,12 +9,98 @@ import (
 )
 
 type Config struct {
-	Port        string        `yaml:"port"`
-	Env         string        `yaml:"env"`
-	Storagepath string        `yaml:"storage_path"`
-	TokenTTL    time.Duration `yaml:"tokenttl"`
+	Port    string        `yaml:"port"`
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+	Env     string        `yaml:"env"`
+	Storage Storage       `yaml:"storage"`
+	// TokenTTL is the lifetime of access tokens, RefreshTokenTTL the idle
+	// lifetime of a session that is extended on every refresh.
+	TokenTTL        time.Duration `yaml:"tokenttl" env-default:"15m"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
+	// PasswordResetTTL is how long an admin issued reset token can be used.
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl" env-default:"1h"`
+	// WelcomeGrant is credited to new users, zero disables it. Like all
+	// defaults of fields where zero is meaningful it is set in MustLoad,
+	// cleanenv would replace an explicit zero with an env-default.
+	WelcomeGrant  int           `yaml:"welcome_grant"`
+	JWT           JWT           `yaml:"jwt"`
+	Registration  Registration  `yaml:"registration"`
+	LoginThrottle LoginThrottle `yaml:"login_throttle"`
+	OIDC          OIDC          `yaml:"oidc"`
+	// LegacyAuthorizeHeader also accepts access tokens in the nonstandard
+	// Authorize header older clients send, next to Authorization. It has no
+	// env-default since cleanenv would turn an explicit false back on.
+	LegacyAuthorizeHeader bool `yaml:"legacy_authorize_header" env:"LEGACY_AUTHORIZE_HEADER"`
+	// TrustedProxies are the proxy addresses allowed to set the client IP
+	// with X-Forwarded-For, the connection address is used otherwise.
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
+// OIDC configures single sign-on with an OpenID Connect provider next to
+// password logins. It is disabled while Issuer is empty.
+type OIDC struct {
+	// Issuer is the provider URL the discovery document is fetched from.
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	// RedirectURL is the public URL of GET /api/auth/oidc/callback.
+	RedirectURL string `yaml:"redirect_url"`
+	// UsernameClaim is the id token claim new shop usernames are made from.
+	UsernameClaim string   `yaml:"username_claim" env-default:"preferred_username"`
+	Scopes        []string `yaml:"scopes"`
+}
+
+type LoginThrottle struct {
+	// Store is where failed login counters are kept, only "memory" for now.
+	Store            string        `yaml:"store" env-default:"memory"`
+	UsernameAttempts int           `yaml:"username_attempts" env-default:"5"`
+	IPAttempts       int           `yaml:"ip_attempts" env-default:"20"`
+	BaseDelay        time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay         time.Duration `yaml:"max_delay" env-default:"15m"`
+	Window           time.Duration `yaml:"window" env-default:"1h"`
+}
+
+type Registration struct {
+	// Mode is "auto" to register unknown users on login as the Avito spec
+	// requires, or "explicit" to only create accounts with POST /api/register.
+	Mode              string `yaml:"mode" env-default:"auto"`
+	MinPasswordLength int    `yaml:"min_password_length" env-default:"8"`
+}
+
+// JWT configures the keys access tokens are signed with. Without keys tokens
+// are signed with HS256 and the SECRET environment variable.
+type JWT struct {
+	// SigningKey is the id of the key new tokens are signed with.
+	SigningKey string `yaml:"signing_key"`
+	// Keys are all keys tokens are accepted from. Keep the previous key
+	// here after a rotation until the tokens it signed have expired.
+	Keys []JWTKey `yaml:"keys"`
+}
+
+type JWTKey struct {
+	// Id is sent as the kid header and published in the JWKS.
+	Id string `yaml:"id"`
+	// Algorithm is "RS256" or "EdDSA".
+	Algorithm string `yaml:"algorithm"`
+	// PrivateKey is the path to a PEM private key. Keys with only a
+	// PublicKey path can verify but not sign tokens.
+	PrivateKey string `yaml:"private_key"`
+	PublicKey  string `yaml:"public_key"`
+}
+
+type Storage struct {
+	// Driver is one of "postgres", "sqlite" or "memory".
+	Driver string `yaml:"driver" env-default:"postgres"`
+	// Path is the connection string for postgres or the database file for sqlite.
+	Path string `yaml:"path"`
+	// MigrateOnStart applies pending schema migrations when the server
+	// starts. It defaults to true in MustLoad, an env-default would turn an
+	// explicit false back on.
+	MigrateOnStart bool `yaml:"migrate_on_start"`
+}
+
+const defaultWelcomeGrant = 1000
+
 func MustLoad() *Config {
 	path := fetchConfigPath()
 	if path == "" {
@@ -23,7 +109,10 @@ func MustLoad() *Config {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		panic("config file does not exist:" + path)
 	}
-	var cfg Config
+	cfg := Config{
+		WelcomeGrant: defaultWelcomeGrant,
+		Storage:      Storage{MigrateOnStart: true},
+	}
 	if err := cleanenv.ReadConfig(path, &cfg); err != nil {
 		panic("failed to read config" + err.Error())
 	}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/splashk1e/avito-shop/internal/models"
+)
+
+type adjustmentRequest struct {
+	Amount int    `json:"amount" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+type adjustmentResponse struct {
+	TransactionId int `json:"transactionId"`
+}
+
+type adjustFunc func(ctx context.Context, actor, username string, amount int, reason string, key *models.IdempotencyKey) (int, error)
+
+func (h *Handler) CreditUser(ctx *gin.Context) {
+	h.adjustBalance(ctx, h.transactionService.Credit)
+}
+
+func (h *Handler) DebitUser(ctx *gin.Context) {
+	h.adjustBalance(ctx, h.transactionService.Debit)
+}
+
+func (h *Handler) adjustBalance(ctx *gin.Context, adjust adjustFunc) {
+	var req adjustmentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		bindErrorResponse(ctx, err)
+		return
+	}
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
+	}
+	id, err := adjust(ctx, caller.Username, ctx.Param("username"), req.Amount, req.Reason, idempotencyKeyFrom(ctx))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, adjustmentResponse{TransactionId: id})
+}
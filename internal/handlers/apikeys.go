@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/splashk1e/avito-shop/internal/models"
+)
+
+type createServiceAccountRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type issueAPIKeyRequest struct {
+	Scopes []string `json:"scopes" binding:"required"`
+	// ExpiresIn is the key lifetime in seconds, keys without it don't expire.
+	ExpiresIn int `json:"expiresIn"`
+}
+
+type apiKeyResponse struct {
+	Id         string     `json:"id"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"createdBy,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	Revoked    bool       `json:"revoked"`
+}
+
+type issueAPIKeyResponse struct {
+	// Key is only returned once, when it is issued.
+	Key string `json:"key"`
+	apiKeyResponse
+}
+
+func newAPIKeyResponse(key models.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		Id:         key.Id,
+		Scopes:     key.Scopes,
+		CreatedBy:  key.CreatedBy,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		Revoked:    key.Revoked,
+	}
+}
+
+func (h *Handler) CreateServiceAccount(ctx *gin.Context) {
+	var req createServiceAccountRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		bindErrorResponse(ctx, err)
+		return
+	}
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
+	}
+	if err := h.apiKeyService.CreateServiceAccount(ctx, caller.Username, req.Name); err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusCreated)
+}
+
+func (h *Handler) IssueAPIKey(ctx *gin.Context) {
+	var req issueAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		bindErrorResponse(ctx, err)
+		return
+	}
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
+	}
+	ttl := time.Duration(req.ExpiresIn) * time.Second
+	token, key, err := h.apiKeyService.IssueAPIKey(ctx, caller.Username, ctx.Param("name"), req.Scopes, ttl)
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, issueAPIKeyResponse{Key: token, apiKeyResponse: newAPIKeyResponse(*key)})
+}
+
+func (h *Handler) ListAPIKeys(ctx *gin.Context) {
+	keys, err := h.apiKeyService.ListAPIKeys(ctx, ctx.Param("name"))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	response := make([]apiKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, newAPIKeyResponse(key))
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) RevokeAPIKey(ctx *gin.Context) {
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
+	}
+	if err := h.apiKeyService.RevokeAPIKey(ctx, caller.Username, ctx.Param("name"), ctx.Param("id")); err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestRefreshRotatesTheRefreshToken(t *testing.T) {
+	shop := newTestShop(t)
+	login := shop.tokens("alice")
+
+	rec := shop.do(http.MethodPost, "/api/auth/refresh", "", refreshRequest{RefreshToken: login.RefreshToken})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: %d %s", rec.Code, rec.Body)
+	}
+	refreshed := decode[responseToken](t, rec)
+	if refreshed.RefreshToken == login.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+	if rec := shop.do(http.MethodGet, "/api/info", refreshed.Token, nil); rec.Code != http.StatusOK {
+		t.Fatalf("info with the refreshed token: %d %s", rec.Code, rec.Body)
+	}
+	if rec := shop.do(http.MethodPost, "/api/auth/refresh", "", refreshRequest{RefreshToken: refreshed.RefreshToken}); rec.Code != http.StatusOK {
+		t.Fatalf("second refresh: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRefreshTokenReuseRevokesTheSession(t *testing.T) {
+	shop := newTestShop(t)
+	login := shop.tokens("alice")
+	refreshed := decode[responseToken](t, shop.do(http.MethodPost, "/api/auth/refresh", "", refreshRequest{RefreshToken: login.RefreshToken}))
+
+	// the first refresh token was stolen and is replayed
+	expectError(t, shop.do(http.MethodPost, "/api/auth/refresh", "", refreshRequest{RefreshToken: login.RefreshToken}), http.StatusUnauthorized, "invalid_token")
+	expectError(t, shop.do(http.MethodPost, "/api/auth/refresh", "", refreshRequest{RefreshToken: refreshed.RefreshToken}), http.StatusUnauthorized, "invalid_token")
+	// other sessions of the user are not affected
+	other := shop.tokens("alice")
+	if rec := shop.do(http.MethodPost, "/api/auth/refresh", "", refreshRequest{RefreshToken: other.RefreshToken}); rec.Code != http.StatusOK {
+		t.Fatalf("refresh of another session: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	shop := newTestShop(t)
+	login := shop.tokens("alice")
+
+	if rec := shop.do(http.MethodPost, "/api/auth/logout", login.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("logout: %d %s", rec.Code, rec.Body)
+	}
+	expectError(t, shop.do(http.MethodGet, "/api/info", login.Token, nil), http.StatusUnauthorized, "invalid_token")
+	expectError(t, shop.do(http.MethodPost, "/api/auth/refresh", "", refreshRequest{RefreshToken: login.RefreshToken}), http.StatusUnauthorized, "invalid_token")
+}
+
+func TestLoginLockout(t *testing.T) {
+	shop := newTestShop(t)
+	shop.login("alice")
+	wrong := User{Username: "alice", Password: "wrong-password"}
+
+	for i := 0; i < 3; i++ {
+		expectError(t, shop.do(http.MethodPost, "/api/auth", "", wrong), http.StatusUnauthorized, "invalid_credentials")
+	}
+	rec := shop.do(http.MethodPost, "/api/auth", "", User{Username: "alice", Password: testPassword})
+	expectError(t, rec, http.StatusTooManyRequests, "too_many_attempts")
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 || retryAfter > 60 {
+		t.Errorf("Retry-After = %q", rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestPasswordChangeSharesTheLoginThrottle(t *testing.T) {
+	shop := newTestShop(t)
+	token := shop.login("alice")
+	change := changePasswordRequest{OldPassword: "wrong-password", NewPassword: "brand-new-password"}
+
+	for i := 0; i < 3; i++ {
+		expectError(t, shop.do(http.MethodPost, "/api/me/password", token, change), http.StatusForbidden, "wrong_password")
+	}
+	change.OldPassword = testPassword
+	expectError(t, shop.do(http.MethodPost, "/api/me/password", token, change), http.StatusTooManyRequests, "too_many_attempts")
+	expectError(t, shop.do(http.MethodPost, "/api/auth", "", User{Username: "alice", Password: testPassword}), http.StatusTooManyRequests, "too_many_attempts")
+}
+
+func TestAutoRegistrationAcceptsAnyPassword(t *testing.T) {
+	shop := newTestShop(t)
+	shop.login("bob")
+	// the Avito spec registers whatever the first login sends
+	if rec := shop.do(http.MethodPost, "/api/auth", "", User{Username: "alice", Password: "short"}); rec.Code != http.StatusOK {
+		t.Fatalf("auto-registration with a short password: %d %s", rec.Code, rec.Body)
+	}
+	expectError(t, shop.do(http.MethodPost, "/api/auth", "", User{Username: "bob", Password: "short"}), http.StatusUnauthorized, "invalid_credentials")
+}
+
+func TestRegisterChecksPasswordPolicy(t *testing.T) {
+	shop := newTestShop(t)
+	expectError(t, shop.do(http.MethodPost, "/api/register", "", User{Username: "alice", Password: "short"}), http.StatusBadRequest, "weak_password")
+	expectError(t, shop.do(http.MethodPost, "/api/register", "", User{Username: "alice-smith", Password: "Alice-Smith"}), http.StatusBadRequest, "weak_password")
+	if rec := shop.do(http.MethodPost, "/api/register", "", User{Username: "alice", Password: testPassword}); rec.Code >= 300 {
+		t.Fatalf("register: %d %s", rec.Code, rec.Body)
+	}
+}
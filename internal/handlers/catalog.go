@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/services"
+)
+
+type itemResponse struct {
+	Name         string `json:"name"`
+	Price        int    `json:"price"`
+	Description  string `json:"description"`
+	Available    bool   `json:"available"`
+	Stock        *int   `json:"stock,omitempty"`
+	PerUserLimit *int   `json:"perUserLimit,omitempty"`
+}
+
+func newItemResponse(item models.MerchItem) itemResponse {
+	return itemResponse{
+		Name:         item.Name,
+		Price:        item.Price,
+		Description:  item.Description,
+		Available:    item.Available,
+		Stock:        item.Stock,
+		PerUserLimit: item.PerUserLimit,
+	}
+}
+
+func (h *Handler) GetItems(ctx *gin.Context) {
+	items, err := h.catalogService.GetItems(ctx)
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	response := make([]itemResponse, 0, len(items))
+	for _, item := range items {
+		response = append(response, newItemResponse(item))
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) GetItem(ctx *gin.Context) {
+	item, err := h.catalogService.GetItem(ctx, ctx.Param("item"))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, newItemResponse(*item))
+}
+
+type createItemRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Price        *int   `json:"price"`
+	Description  string `json:"description"`
+	Stock        *int   `json:"stock"`
+	PerUserLimit *int   `json:"perUserLimit"`
+}
+
+type updateItemRequest struct {
+	Price        *int        `json:"price"`
+	Description  *string     `json:"description"`
+	Stock        optionalInt `json:"stock"`
+	PerUserLimit optionalInt `json:"perUserLimit"`
+}
+
+// optionalInt tells a field set to null apart from a missing one.
+type optionalInt struct {
+	Set   bool
+	Value *int
+}
+
+func (o *optionalInt) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+type itemPriceResponse struct {
+	Price     int       `json:"price"`
+	ValidFrom time.Time `json:"validFrom"`
+	ChangedBy string    `json:"changedBy,omitempty"`
+}
+
+func (h *Handler) CreateItem(ctx *gin.Context) {
+	var req createItemRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		bindErrorResponse(ctx, err)
+		return
+	}
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
+	}
+	var price int
+	if req.Price != nil {
+		price = *req.Price
+	}
+	item, err := h.catalogService.CreateItem(ctx, caller.Username, models.MerchItem{
+		Name:         req.Name,
+		Price:        price,
+		Description:  req.Description,
+		Stock:        req.Stock,
+		PerUserLimit: req.PerUserLimit,
+	})
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, newItemResponse(*item))
+}
+
+func (h *Handler) UpdateItem(ctx *gin.Context) {
+	var req updateItemRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		bindErrorResponse(ctx, err)
+		return
+	}
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
+	}
+	item, err := h.catalogService.UpdateItem(ctx, caller.Username, ctx.Param("item"), services.ItemUpdate{
+		Price:           req.Price,
+		Description:     req.Description,
+		SetStock:        req.Stock.Set,
+		Stock:           req.Stock.Value,
+		SetPerUserLimit: req.PerUserLimit.Set,
+		PerUserLimit:    req.PerUserLimit.Value,
+	})
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, newItemResponse(*item))
+}
+
+func (h *Handler) RetireItem(ctx *gin.Context) {
+	h.setItemAvailable(ctx, h.catalogService.RetireItem)
+}
+
+func (h *Handler) RestoreItem(ctx *gin.Context) {
+	h.setItemAvailable(ctx, h.catalogService.RestoreItem)
+}
+
+func (h *Handler) setItemAvailable(ctx *gin.Context, set func(ctx context.Context, actor, name string) error) {
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
+	}
+	if err := set(ctx, caller.Username, ctx.Param("item")); err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	h.GetItem(ctx)
+}
+
+func (h *Handler) GetItemPrices(ctx *gin.Context) {
+	prices, err := h.catalogService.GetItemPrices(ctx, ctx.Param("item"))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	response := make([]itemPriceResponse, 0, len(prices))
+	for _, price := range prices {
+		response = append(response, itemPriceResponse{
+			Price:     price.Price,
+			ValidFrom: price.ValidFrom,
+			ChangedBy: price.ChangedBy,
+		})
+	}
+	ctx.JSON(http.StatusOK, response)
+}
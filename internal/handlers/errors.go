@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/splashk1e/avito-shop/internal/services"
+)
+
+// apiError is an entry of the error catalogue. Code is stable and meant for
+// clients to switch on, Message may change.
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+// Errors raised by the handlers themselves.
+var (
+	errInvalidRequest    = apiError{http.StatusBadRequest, "invalid_request", "request is invalid"}
+	errUnauthorized      = apiError{http.StatusUnauthorized, "unauthorized", "authentication is required"}
+	errInvalidToken      = apiError{http.StatusUnauthorized, "invalid_token", "invalid token"}
+	errInsufficientScope = apiError{http.StatusForbidden, "insufficient_scope", "missing a required scope"}
+	errNotFound          = apiError{http.StatusNotFound, "not_found", "no such endpoint"}
+	errNotAllowed        = apiError{http.StatusMethodNotAllowed, "method_not_allowed", "method is not allowed"}
+	errUserNotFound      = apiError{http.StatusNotFound, "user_not_found", "user not found"}
+	errWrongPassword     = apiError{http.StatusForbidden, "wrong_password", "old password is incorrect"}
+	errSSOFailed         = apiError{http.StatusUnauthorized, "sso_failed", "single sign-on failed"}
+	errInternal          = apiError{http.StatusInternalServerError, "internal_error", "internal server error"}
+)
+
+// errorCatalogue maps service errors to what clients see. Errors missing
+// here are internal errors, their text is only logged.
+var errorCatalogue = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{services.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+	{services.ErrInvalidToken, http.StatusUnauthorized, "invalid_token"},
+	{services.ErrInvalidAPIKey, http.StatusUnauthorized, "invalid_api_key"},
+	{services.ErrInvalidOIDCLogin, http.StatusUnauthorized, "sso_failed"},
+	{services.ErrInvalidResetToken, http.StatusUnauthorized, "invalid_reset_token"},
+	{services.ErrTooManyAttempts, http.StatusTooManyRequests, "too_many_attempts"},
+
+	{services.ErrUserNotFound, http.StatusNotFound, "user_not_found"},
+	{services.ErrUserExists, http.StatusConflict, "user_exists"},
+	{services.ErrInvalidUsername, http.StatusBadRequest, "invalid_username"},
+	{services.ErrWeakPassword, http.StatusBadRequest, "weak_password"},
+	{services.ErrServiceAccountNotFound, http.StatusNotFound, "service_account_not_found"},
+	{services.ErrAPIKeyNotFound, http.StatusNotFound, "api_key_not_found"},
+	{services.ErrInvalidScope, http.StatusBadRequest, "invalid_scope"},
+	{services.ErrInvalidExpiry, http.StatusBadRequest, "invalid_expiry"},
+
+	{services.ErrNoCoins, http.StatusBadRequest, "insufficient_funds"},
+	{services.ErrInvalidAmount, http.StatusBadRequest, "invalid_amount"},
+	{services.ErrSelfTransfer, http.StatusBadRequest, "self_transfer"},
+	{services.ErrReasonRequired, http.StatusBadRequest, "reason_required"},
+	{services.ErrInvalidFilter, http.StatusBadRequest, "invalid_filter"},
+	{services.ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor"},
+
+	{services.ErrItemNotFound, http.StatusNotFound, "item_not_found"},
+	{services.ErrItemExists, http.StatusConflict, "item_exists"},
+	{services.ErrItemRetired, http.StatusConflict, "item_retired"},
+	{services.ErrSoldOut, http.StatusConflict, "sold_out"},
+	{services.ErrPriceChanged, http.StatusConflict, "price_changed"},
+	{services.ErrLimitReached, http.StatusForbidden, "limit_reached"},
+	{services.ErrInvalidQuantity, http.StatusBadRequest, "invalid_quantity"},
+	{services.ErrInvalidItemName, http.StatusBadRequest, "invalid_item_name"},
+	{services.ErrInvalidPrice, http.StatusBadRequest, "invalid_price"},
+	{services.ErrInvalidStock, http.StatusBadRequest, "invalid_stock"},
+	{services.ErrInvalidLimit, http.StatusBadRequest, "invalid_limit"},
+
+	{services.ErrKeyReused, http.StatusUnprocessableEntity, "idempotency_key_reused"},
+	{services.ErrKeyInProgress, http.StatusConflict, "idempotency_key_in_progress"},
+	{services.ErrKeyProcessed, http.StatusConflict, "idempotency_key_processed"},
+}
+
+// lookupError returns the catalogue entry of err and the detail of its
+// services.DetailError, if any.
+func lookupError(err error) (apiError, string, bool) {
+	for _, entry := range errorCatalogue {
+		if !errors.Is(err, entry.err) {
+			continue
+		}
+		return apiError{entry.status, entry.code, entry.err.Error()}, errorDetail(err, entry.err), true
+	}
+	return apiError{}, "", false
+}
+
+func errorDetail(err, sentinel error) string {
+	var detailed *services.DetailError
+	if !errors.As(err, &detailed) || !errors.Is(detailed.Err, sentinel) {
+		return ""
+	}
+	return detailed.Detail
+}
@@ -2,32 +2,95 @@ package handlers
 
 import (
 	"errors"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/splashk1e/avito-shop/internal/models"
 	"github.com/splashk1e/avito-shop/internal/services"
 )
 
 type Handler struct {
 	authservice        *services.AuthService
 	transactionService *services.TransactionService
+	catalogService     *services.CatalogService
+	idempotencyService *services.IdempotencyService
+	loginGuard         *services.LoginGuard
+	apiKeyService      *services.APIKeyService
+	// legacyAuthHeader also accepts tokens in the Authorize header.
+	legacyAuthHeader bool
+	// oidcService is nil when single sign-on is not configured.
+	oidcService *services.OIDCService
+	log         *slog.Logger
 }
 
-func NewHandler(authservice *services.AuthService, transactionService *services.TransactionService) *Handler {
+func NewHandler(authservice *services.AuthService, transactionService *services.TransactionService, catalogService *services.CatalogService, idempotencyService *services.IdempotencyService, loginGuard *services.LoginGuard, apiKeyService *services.APIKeyService, oidcService *services.OIDCService, legacyAuthHeader bool, log *slog.Logger) *Handler {
 	return &Handler{
 		authservice:        authservice,
 		transactionService: transactionService,
+		catalogService:     catalogService,
+		idempotencyService: idempotencyService,
+		loginGuard:         loginGuard,
+		apiKeyService:      apiKeyService,
+		oidcService:        oidcService,
+		legacyAuthHeader:   legacyAuthHeader,
+		log:                log,
 	}
 }
 func (handler *Handler) InitRoutes() *gin.Engine {
 	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.Use(handler.requestId)
+	router.NoRoute(noRoute)
+	router.NoMethod(noMethod)
+	router.GET("/.well-known/jwks.json", handler.JWKS)
 	router.POST("/api/auth", handler.Auth)
+	router.POST("/api/register", handler.Register)
+	router.POST("/api/auth/refresh", handler.Refresh)
+	router.POST("/api/password/reset", handler.ResetPassword)
+	if handler.oidcService != nil {
+		router.GET("/api/auth/oidc/login", handler.OIDCLogin)
+		router.GET("/api/auth/oidc/callback", handler.OIDCCallback)
+	}
 	api := router.Group("/api", handler.userIndentity)
+	account := api.Group("", requireScope(models.ScopeAccount))
 	{
-
-		api.GET("/buy/:item", handler.BuyItem)
-		api.POST("/sendCoin", handler.SendCoin)
-		api.GET("/info", handler.Info)
+		account.POST("/auth/logout", handler.Logout)
+		account.POST("/me/password", handler.ChangePassword)
+		account.POST("/buy", handler.idempotency, handler.Buy)
+		account.GET("/buy/:item", handler.idempotency, handler.BuyItem)
+		account.POST("/sendCoin", handler.idempotency, handler.SendCoin)
+		account.GET("/info", handler.Info)
+		account.GET("/transactions", handler.ListTransactions)
+	}
+	catalog := api.Group("/items", requireScope(models.ScopeCatalogRead))
+	{
+		catalog.GET("", handler.GetItems)
+		catalog.GET("/:item", handler.GetItem)
+	}
+	admin := api.Group("/admin")
+	{
+		admin.POST("/users/:username/credit", requireScope(models.ScopeCoinsGrant), handler.idempotency, handler.CreditUser)
+		admin.POST("/users/:username/debit", requireScope(models.ScopeCoinsDebit), handler.idempotency, handler.DebitUser)
+		admin.GET("/users/:username/info", requireScope(models.ScopeInfoRead), handler.UserInfo)
+		admin.POST("/users/:username/password-reset", requireScope(models.ScopeUsersManage), handler.IssuePasswordReset)
+	}
+	catalogAdmin := admin.Group("/items", requireScope(models.ScopeCatalogWrite))
+	{
+		catalogAdmin.POST("", handler.CreateItem)
+		catalogAdmin.PATCH("/:item", handler.UpdateItem)
+		catalogAdmin.POST("/:item/retire", handler.RetireItem)
+		catalogAdmin.POST("/:item/restore", handler.RestoreItem)
+		catalogAdmin.GET("/:item/prices", handler.GetItemPrices)
+	}
+	serviceAccounts := admin.Group("/service-accounts", requireScope(models.ScopeUsersManage))
+	{
+		serviceAccounts.POST("", handler.CreateServiceAccount)
+		serviceAccounts.GET("/:name/keys", handler.ListAPIKeys)
+		serviceAccounts.POST("/:name/keys", handler.IssueAPIKey)
+		serviceAccounts.DELETE("/:name/keys/:id", handler.RevokeAPIKey)
 	}
 
 	return router
@@ -38,40 +101,171 @@ type User struct {
 	Password string `json:"password"`
 }
 type responseToken struct {
-	token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+func newResponseToken(tokens *models.TokenPair) responseToken {
+	return responseToken{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int(tokens.ExpiresIn.Seconds()),
+	}
 }
 
 func (h *Handler) Auth(ctx *gin.Context) {
 	var user User
 	if err := ctx.ShouldBindJSON(&user); err != nil {
-		newErrorResponse(ctx, http.StatusBadRequest, err.Error())
+		bindErrorResponse(ctx, err)
+		return
+	}
+	ip := ctx.ClientIP()
+	attempts, err := h.loginGuard.Begin(ctx, user.Username, ip)
+	if err != nil {
+		throttledResponse(ctx, err)
+		return
 	}
-	token, err := h.authservice.Login(ctx, user.Username, user.Password)
+	tokens, err := h.authservice.Login(ctx, user.Username, user.Password)
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidCredentials) {
-			newErrorResponse(ctx, http.StatusUnauthorized, err.Error())
+		// the attempt stays counted only for wrong credentials
+		if !errors.Is(err, services.ErrInvalidCredentials) {
+			h.loginGuard.Refund(ctx, attempts)
 		}
-		newErrorResponse(ctx, http.StatusInternalServerError, err.Error())
+		errorResponse(ctx, err)
+		return
 	}
-	response := responseToken{token: token}
-	ctx.JSON(http.StatusOK, response)
+	h.loginGuard.Succeed(ctx, user.Username, attempts)
+	ctx.JSON(http.StatusOK, newResponseToken(tokens))
 }
 
-func (h *Handler) BuyItem(ctx *gin.Context) {
-	item := ctx.Param("item")
-	username, ok := ctx.Keys["username"].(string)
+// throttledResponse answers a request refused by the login guard, lockouts
+// tell the client when to retry.
+func throttledResponse(ctx *gin.Context, err error) {
+	var lockout *services.LockoutError
+	if errors.As(err, &lockout) {
+		retryAfter := int(math.Ceil(lockout.RetryAfter.Seconds()))
+		ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+		e, _, _ := lookupError(err)
+		newErrorResponse(ctx, e, gin.H{"retryAfter": retryAfter})
+		return
+	}
+	errorResponse(ctx, err)
+}
+
+// JWKS publishes the public keys of access tokens for other services.
+func (h *Handler) JWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.authservice.JWKS())
+}
+
+func (h *Handler) Register(ctx *gin.Context) {
+	var user User
+	if err := ctx.ShouldBindJSON(&user); err != nil {
+		bindErrorResponse(ctx, err)
+		return
+	}
+	tokens, err := h.authservice.Register(ctx, user.Username, user.Password)
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, newResponseToken(tokens))
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+func (h *Handler) Refresh(ctx *gin.Context) {
+	var req refreshRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		bindErrorResponse(ctx, err)
+		return
+	}
+	tokens, err := h.authservice.Refresh(ctx, req.RefreshToken)
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, newResponseToken(tokens))
+}
+
+func (h *Handler) Logout(ctx *gin.Context) {
+	token, ok := ctx.Keys[tokenCtx].(string)
 	if !ok {
-		newErrorResponse(ctx, http.StatusUnauthorized, "unauthorized")
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
 	}
-	if _, err := h.transactionService.SaveTransaction(ctx, username, "", item, 0); err != nil {
-		if errors.Is(err, services.ErrInvalidCredentials) {
-			newErrorResponse(ctx, http.StatusUnauthorized, err.Error())
-		}
-		newErrorResponse(ctx, http.StatusInternalServerError, err.Error())
+	if err := h.authservice.Logout(ctx, token); err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.AbortWithStatus(http.StatusNoContent)
+}
+
+type buyRequest struct {
+	Item     string `json:"item" binding:"required"`
+	Quantity *int   `json:"quantity"`
+}
+
+type receiptResponse struct {
+	TransactionId int    `json:"transactionId"`
+	Item          string `json:"item"`
+	Quantity      int    `json:"quantity"`
+	UnitPrice     int    `json:"unitPrice"`
+	Total         int    `json:"total"`
+	Balance       int    `json:"balance"`
+}
+
+func (h *Handler) Buy(ctx *gin.Context) {
+	var req buyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		bindErrorResponse(ctx, err)
+		return
+	}
+	quantity := 1
+	if req.Quantity != nil {
+		quantity = *req.Quantity
+	}
+	receipt, ok := h.buy(ctx, req.Item, quantity)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, receiptResponse{
+		TransactionId: receipt.TransactionId,
+		Item:          receipt.Item,
+		Quantity:      receipt.Quantity,
+		UnitPrice:     receipt.UnitPrice,
+		Total:         receipt.Total,
+		Balance:       receipt.Balance,
+	})
+}
+
+// BuyItem serves the deprecated GET /api/buy/:item route, use Buy instead.
+func (h *Handler) BuyItem(ctx *gin.Context) {
+	ctx.Header("Deprecation", "true")
+	ctx.Header("Link", `</api/buy>; rel="successor-version"`)
+	if _, ok := h.buy(ctx, ctx.Param("item"), 1); !ok {
+		return
 	}
 	ctx.AbortWithStatus(http.StatusOK)
 }
 
+func (h *Handler) buy(ctx *gin.Context, item string, quantity int) (*models.Receipt, bool) {
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return nil, false
+	}
+	receipt, err := h.transactionService.BuyItem(ctx, caller.Username, item, quantity, idempotencyKeyFrom(ctx))
+	if err != nil {
+		errorResponse(ctx, err)
+		return nil, false
+	}
+	return receipt, true
+}
+
 type transacRequest struct {
 	ToUser string `json:"toUser"`
 	Amount int    `json:"amount"`
@@ -80,18 +274,18 @@ type transacRequest struct {
 func (h *Handler) SendCoin(ctx *gin.Context) {
 	var req transacRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		newErrorResponse(ctx, http.StatusBadRequest, err.Error())
+		bindErrorResponse(ctx, err)
+		return
 	}
-	username, ok := ctx.Keys["username"].(string)
+	caller, ok := principalFrom(ctx)
 	if !ok {
-		newErrorResponse(ctx, http.StatusUnauthorized, "unauthorized")
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
 	}
-	_, err := h.transactionService.SaveTransaction(ctx, username, req.ToUser, "", req.Amount)
+	_, err := h.transactionService.SaveTransaction(ctx, caller.Username, req.ToUser, "", req.Amount, idempotencyKeyFrom(ctx))
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidCredentials) {
-			newErrorResponse(ctx, http.StatusUnauthorized, err.Error())
-		}
-		newErrorResponse(ctx, http.StatusInternalServerError, err.Error())
+		errorResponse(ctx, err)
+		return
 	}
 	ctx.AbortWithStatus(http.StatusOK)
 }
@@ -109,52 +303,68 @@ type CoinHistory struct {
 	Recevied []Recevied `json:"recieved"`
 	Sent     []Sent     `json:"sent"`
 }
+type InventoryItem struct {
+	Type     string `json:"type"`
+	Quantity int    `json:"quantity"`
+}
+
 type infoResponse struct {
-	Coins       int         `json:"coins"`
-	Inventory   []string    `json:"inventory"`
-	CoinHistory CoinHistory `json:"coinHistory"`
+	Coins       int             `json:"coins"`
+	Inventory   []InventoryItem `json:"inventory"`
+	CoinHistory CoinHistory     `json:"coinHistory"`
 }
 
 func (h *Handler) Info(ctx *gin.Context) {
-	var infoResponse infoResponse
-	sent := make([]Sent, 0)
-	recieved := make([]Recevied, 0)
-	username, ok := ctx.Keys["username"].(string)
+	caller, ok := principalFrom(ctx)
 	if !ok {
-		newErrorResponse(ctx, http.StatusUnauthorized, "unauthorized")
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
 	}
-	transactions, err := h.transactionService.GetTransactions(ctx, username)
+	h.info(ctx, caller.Username, errUnauthorized)
+}
+
+// UserInfo is Info of any user, for admins and API keys with info:read.
+func (h *Handler) UserInfo(ctx *gin.Context) {
+	h.info(ctx, ctx.Param("username"), errUserNotFound)
+}
+
+func (h *Handler) info(ctx *gin.Context, username string, unknownUser apiError) {
+	var infoResponse infoResponse
+	coins, err := h.authservice.GetCoinsInfo(ctx, username)
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidCredentials) {
-			newErrorResponse(ctx, http.StatusUnauthorized, err.Error())
-		}
-		newErrorResponse(ctx, http.StatusInternalServerError, err.Error())
+		infoErrorResponse(ctx, err, unknownUser)
+		return
 	}
-	coins, err := h.authservice.GetCoinsInfo(ctx, username)
+	inventory, err := h.transactionService.GetInventory(ctx, username)
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidCredentials) {
-			newErrorResponse(ctx, http.StatusUnauthorized, err.Error())
-		}
-		newErrorResponse(ctx, http.StatusInternalServerError, err.Error())
+		infoErrorResponse(ctx, err, unknownUser)
+		return
 	}
-	items, err := h.transactionService.GetItems(ctx, username)
+	history, err := h.transactionService.GetCoinHistory(ctx, username)
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidCredentials) {
-			newErrorResponse(ctx, http.StatusUnauthorized, err.Error())
-		}
-		newErrorResponse(ctx, http.StatusInternalServerError, err.Error())
+		infoErrorResponse(ctx, err, unknownUser)
+		return
 	}
-	infoResponse.Inventory = items
-	for _, val := range transactions {
-		if val.Sender == username {
-			sent = append(sent, Sent{Amount: val.Amount, ToUser: val.Reciever})
-		}
-		if val.Reciever == username {
-			recieved = append(recieved, Recevied{Amount: val.Amount, FromUser: val.Sender})
-		}
+	infoResponse.Inventory = make([]InventoryItem, 0, len(inventory))
+	for _, item := range inventory {
+		infoResponse.Inventory = append(infoResponse.Inventory, InventoryItem{Type: item.Type, Quantity: item.Quantity})
+	}
+	infoResponse.CoinHistory.Recevied = make([]Recevied, 0, len(history.Received))
+	for _, val := range history.Received {
+		infoResponse.CoinHistory.Recevied = append(infoResponse.CoinHistory.Recevied, Recevied{FromUser: val.User, Amount: val.Amount})
+	}
+	infoResponse.CoinHistory.Sent = make([]Sent, 0, len(history.Sent))
+	for _, val := range history.Sent {
+		infoResponse.CoinHistory.Sent = append(infoResponse.CoinHistory.Sent, Sent{ToUser: val.User, Amount: val.Amount})
 	}
-	infoResponse.CoinHistory.Recevied = recieved
-	infoResponse.CoinHistory.Sent = sent
 	infoResponse.Coins = coins
 	ctx.JSON(http.StatusOK, infoResponse)
 }
+
+func infoErrorResponse(ctx *gin.Context, err error, unknownUser apiError) {
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		newErrorResponse(ctx, unknownUser, nil)
+		return
+	}
+	errorResponse(ctx, err)
+}
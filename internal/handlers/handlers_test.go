@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/splashk1e/avito-shop/internal/lib/jwt"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/services"
+	"github.com/splashk1e/avito-shop/internal/storage/memory"
+)
+
+const (
+	testWelcomeGrant = 1000
+	testPassword     = "correct-horse-1"
+)
+
+// testShop is the full router on memory storage.
+type testShop struct {
+	t       *testing.T
+	storage *memory.Storage
+	router  *gin.Engine
+}
+
+func newTestShop(t *testing.T) *testShop {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.New()
+	keys, err := jwt.NewHMACKeySet("test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := services.NewAuthService(log, store, store, store, store, 15*time.Minute, time.Hour, time.Hour, keys, testWelcomeGrant,
+		services.RegistrationPolicy{AutoRegister: true, MinPasswordLength: 8})
+	guard := services.NewLoginGuard(memory.NewAttemptStore(), services.LoginThrottlePolicy{
+		UsernameAttempts: 3,
+		IPAttempts:       100,
+		BaseDelay:        time.Minute,
+		MaxDelay:         time.Hour,
+		Window:           time.Hour,
+	}, log)
+	handler := NewHandler(auth,
+		services.NewTransactionsService(store, store, store, log),
+		services.NewCatalogService(store, store, log),
+		services.NewIdempotencyService(store, log),
+		guard,
+		services.NewAPIKeyService(store, store, log),
+		nil, false, log)
+	return &testShop{t: t, storage: store, router: handler.InitRoutes()}
+}
+
+// do sends a request, body is encoded as JSON unless it is a string.
+// headers are name and value pairs.
+func (s *testShop) do(method, path, token string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		req.Header.Set(authorizationHeader, bearerScheme+" "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// login registers username on first use and returns its access token.
+func (s *testShop) login(username string) string {
+	s.t.Helper()
+	return s.tokens(username).Token
+}
+
+func (s *testShop) tokens(username string) responseToken {
+	s.t.Helper()
+	rec := s.do(http.MethodPost, "/api/auth", "", User{Username: username, Password: testPassword})
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("login %s: %d %s", username, rec.Code, rec.Body)
+	}
+	return decode[responseToken](s.t, rec)
+}
+
+// admin returns the access token of a new admin user.
+func (s *testShop) admin(username string) string {
+	s.t.Helper()
+	s.login(username)
+	if err := s.storage.SetUserRole(context.Background(), username, models.RoleAdmin); err != nil {
+		s.t.Fatal(err)
+	}
+	return s.login(username)
+}
+
+func (s *testShop) info(token string) infoResponse {
+	s.t.Helper()
+	rec := s.do(http.MethodGet, "/api/info", token, nil)
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("info: %d %s", rec.Code, rec.Body)
+	}
+	return decode[infoResponse](s.t, rec)
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body, err)
+	}
+	return v
+}
+
+// expectError checks the status and code of an error response.
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) Error {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+	body := decode[Error](t, rec)
+	if body.Code != code {
+		t.Fatalf("code = %q, want %q", body.Code, code)
+	}
+	return body
+}
+
+func TestSpecRoutesKeepSpecStatuses(t *testing.T) {
+	shop := newTestShop(t)
+	token := shop.login("alice")
+	admin := shop.admin("boss")
+	if rec := shop.do(http.MethodPost, "/api/admin/items", admin, createItemRequest{Name: "gone", Price: intPtr(5)}); rec.Code != http.StatusCreated {
+		t.Fatalf("create item: %d %s", rec.Code, rec.Body)
+	}
+	if rec := shop.do(http.MethodPost, "/api/admin/items/gone/retire", admin, nil); rec.Code >= 300 {
+		t.Fatalf("retire item: %d %s", rec.Code, rec.Body)
+	}
+
+	expectError(t, shop.do(http.MethodPost, "/api/sendCoin", token, transacRequest{ToUser: "nobody", Amount: 1}), http.StatusBadRequest, "user_not_found")
+	expectError(t, shop.do(http.MethodGet, "/api/buy/nosuch", token, nil), http.StatusBadRequest, "item_not_found")
+	expectError(t, shop.do(http.MethodGet, "/api/buy/gone", token, nil), http.StatusBadRequest, "item_retired")
+	// routes outside the spec keep the catalogue status
+	expectError(t, shop.do(http.MethodPost, "/api/buy", token, map[string]interface{}{"item": "nosuch"}), http.StatusNotFound, "item_not_found")
+	expectError(t, shop.do(http.MethodPost, "/api/buy", token, map[string]interface{}{"item": "gone"}), http.StatusConflict, "item_retired")
+}
+
+func TestBindErrorsHideGoNames(t *testing.T) {
+	shop := newTestShop(t)
+	token := shop.login("alice")
+	for _, body := range []string{`{"toUser": 5}`, `{"toUser":`, `[]`} {
+		rec := shop.do(http.MethodPost, "/api/sendCoin", token, body)
+		expectError(t, rec, http.StatusBadRequest, "invalid_request")
+		for _, leak := range []string{"transacRequest", "ToUser", "Go struct", "json:"} {
+			if bytes.Contains(rec.Body.Bytes(), []byte(leak)) {
+				t.Errorf("body %q leaks %q", rec.Body, leak)
+			}
+		}
+	}
+}
+
+func TestErrorDetailsComeFromServices(t *testing.T) {
+	shop := newTestShop(t)
+	rec := shop.do(http.MethodPost, "/api/register", "", User{Username: "alice", Password: "short"})
+	if body := expectError(t, rec, http.StatusBadRequest, "weak_password"); body.Details != "it must be at least 8 characters long" {
+		t.Errorf("details = %v", body.Details)
+	}
+	shop.login("bob")
+	rec = shop.do(http.MethodPost, "/api/auth", "", User{Username: "bob", Password: "wrong-password"})
+	if body := expectError(t, rec, http.StatusUnauthorized, "invalid_credentials"); body.Details != nil {
+		t.Errorf("details = %v", body.Details)
+	}
+}
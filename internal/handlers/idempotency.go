@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/splashk1e/avito-shop/internal/lib/logger/sl"
+	"github.com/splashk1e/avito-shop/internal/models"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	idempotencyKeyCtx        = "idempotency_key"
+)
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(data string) (int, error) {
+	r.body.WriteString(data)
+	return r.ResponseWriter.WriteString(data)
+}
+
+// idempotency replays the stored response when a request is retried with the
+// same Idempotency-Key header, so a retry never performs the operation twice.
+func (h *Handler) idempotency(ctx *gin.Context) {
+	key := ctx.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		ctx.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		newErrorResponse(ctx, errInvalidRequest, "idempotency key is too long")
+		return
+	}
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
+	}
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		newErrorResponse(ctx, errInvalidRequest, nil)
+		return
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	stored, err := h.idempotencyService.Begin(ctx, caller.Username, key, fingerprint(ctx.Request, body))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	if stored.StatusCode != 0 {
+		ctx.Header(idempotentReplayedHeader, "true")
+		if len(stored.Response) == 0 {
+			ctx.AbortWithStatus(stored.StatusCode)
+			return
+		}
+		ctx.Data(stored.StatusCode, gin.MIMEJSON, stored.Response)
+		ctx.Abort()
+		return
+	}
+
+	ctx.Set(idempotencyKeyCtx, stored)
+	recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+	ctx.Writer = recorder
+	ctx.Next()
+
+	// the client may already be gone, the outcome still has to be remembered
+	storeCtx := context.WithoutCancel(ctx.Request.Context())
+	if status := recorder.Status(); status >= http.StatusInternalServerError {
+		err = h.idempotencyService.Release(storeCtx, stored)
+	} else {
+		err = h.idempotencyService.Complete(storeCtx, stored, status, recorder.body.Bytes())
+	}
+	if err != nil {
+		logger(ctx).Error("failed to store idempotency key", slog.String("key", key), sl.Err(err))
+	}
+}
+
+// idempotencyKeyFrom returns the reserved key of the request, handlers pass
+// it on so the key is marked in the database transaction that posts coins.
+// It is nil for requests without an Idempotency-Key header.
+func idempotencyKeyFrom(ctx *gin.Context) *models.IdempotencyKey {
+	key, _ := ctx.Keys[idempotencyKeyCtx].(*models.IdempotencyKey)
+	return key
+}
+
+func fingerprint(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(req.URL.Path))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+)
+
+func TestIdempotentRetryIsReplayed(t *testing.T) {
+	shop := newTestShop(t)
+	alice := shop.login("alice")
+	bob := shop.login("bob")
+	send := transacRequest{ToUser: "bob", Amount: 10}
+
+	first := shop.do(http.MethodPost, "/api/sendCoin", alice, send, idempotencyKeyHeader, "send-1")
+	retry := shop.do(http.MethodPost, "/api/sendCoin", alice, send, idempotencyKeyHeader, "send-1")
+	if first.Code != http.StatusOK || retry.Code != http.StatusOK {
+		t.Fatalf("statuses = %d, %d", first.Code, retry.Code)
+	}
+	if first.Header().Get(idempotentReplayedHeader) != "" || retry.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("replayed headers = %q, %q", first.Header().Get(idempotentReplayedHeader), retry.Header().Get(idempotentReplayedHeader))
+	}
+	if coins := shop.info(bob).Coins; coins != testWelcomeGrant+10 {
+		t.Errorf("bob has %d coins after a retried transfer, want %d", coins, testWelcomeGrant+10)
+	}
+
+	buy := shop.do(http.MethodPost, "/api/buy", alice, map[string]interface{}{"item": "pen"}, idempotencyKeyHeader, "buy-1")
+	buyRetry := shop.do(http.MethodPost, "/api/buy", alice, map[string]interface{}{"item": "pen"}, idempotencyKeyHeader, "buy-1")
+	if buy.Code != http.StatusOK || !bytes.Equal(buy.Body.Bytes(), buyRetry.Body.Bytes()) {
+		t.Errorf("retried purchase answered %d %s, first %d %s", buyRetry.Code, buyRetry.Body, buy.Code, buy.Body)
+	}
+	if inventory := shop.info(alice).Inventory; len(inventory) != 1 || inventory[0].Quantity != 1 {
+		t.Errorf("inventory after a retried purchase = %+v", inventory)
+	}
+}
+
+func TestIdempotencyKeysAreScopedToTheUser(t *testing.T) {
+	shop := newTestShop(t)
+	alice := shop.login("alice")
+	bob := shop.login("bob")
+	shop.login("carol")
+	send := transacRequest{ToUser: "carol", Amount: 10}
+
+	for _, token := range []string{alice, bob} {
+		rec := shop.do(http.MethodPost, "/api/sendCoin", token, send, idempotencyKeyHeader, "same-key")
+		if rec.Code != http.StatusOK || rec.Header().Get(idempotentReplayedHeader) != "" {
+			t.Fatalf("send with another user's key: %d replayed=%q", rec.Code, rec.Header().Get(idempotentReplayedHeader))
+		}
+	}
+}
+
+func TestIdempotencyKeyReuseIsRejected(t *testing.T) {
+	shop := newTestShop(t)
+	alice := shop.login("alice")
+	shop.login("bob")
+
+	if rec := shop.do(http.MethodPost, "/api/sendCoin", alice, transacRequest{ToUser: "bob", Amount: 10}, idempotencyKeyHeader, "k"); rec.Code != http.StatusOK {
+		t.Fatalf("send: %d %s", rec.Code, rec.Body)
+	}
+	rec := shop.do(http.MethodPost, "/api/sendCoin", alice, transacRequest{ToUser: "bob", Amount: 20}, idempotencyKeyHeader, "k")
+	expectError(t, rec, http.StatusUnprocessableEntity, "idempotency_key_reused")
+	if coins := shop.info(alice).Coins; coins != testWelcomeGrant-10 {
+		t.Errorf("alice has %d coins, want %d", coins, testWelcomeGrant-10)
+	}
+}
+
+func TestIdempotencyKeyInProgress(t *testing.T) {
+	shop := newTestShop(t)
+	alice := shop.login("alice")
+	shop.login("bob")
+	body, _ := json.Marshal(transacRequest{ToUser: "bob", Amount: 10})
+	// a request with the key is still running
+	req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", nil)
+	err := shop.storage.ReserveIdempotencyKey(context.Background(), models.IdempotencyKey{
+		Username:    "alice",
+		Key:         "k",
+		Fingerprint: fingerprint(req, body),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := shop.do(http.MethodPost, "/api/sendCoin", alice, string(body), idempotencyKeyHeader, "k")
+	expectError(t, rec, http.StatusConflict, "idempotency_key_in_progress")
+	if coins := shop.info(alice).Coins; coins != testWelcomeGrant {
+		t.Errorf("alice has %d coins, want %d", coins, testWelcomeGrant)
+	}
+}
+
+func TestClientErrorsAreReplayed(t *testing.T) {
+	shop := newTestShop(t)
+	alice := shop.login("alice")
+	shop.login("bob")
+	send := transacRequest{ToUser: "bob", Amount: testWelcomeGrant + 1}
+
+	expectError(t, shop.do(http.MethodPost, "/api/sendCoin", alice, send, idempotencyKeyHeader, "k"), http.StatusBadRequest, "insufficient_funds")
+	// client errors are stored like successes and replayed
+	rec := shop.do(http.MethodPost, "/api/sendCoin", alice, send, idempotencyKeyHeader, "k")
+	expectError(t, rec, http.StatusBadRequest, "insufficient_funds")
+	if rec.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Error("client error was not replayed")
+	}
+}
@@ -1,31 +1,124 @@
 package handlers
 
 import (
-	"net/http"
+	"errors"
+	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/services"
 )
 
 const (
-	authorizationHeader = "Authorize"
-	userCtx             = "username"
+	authorizationHeader = "Authorization"
+	// legacyAuthorizationHeader is the header clients sent tokens in before
+	// Authorization was supported. It is read only while the compatibility
+	// flag is set.
+	legacyAuthorizationHeader = "Authorize"
+	bearerScheme              = "Bearer"
+	authRealm                 = "avito-shop"
+	principalCtx              = "principal"
+	tokenCtx                  = "token"
+	// apiKeyHeader carries the API key of a service account instead of a
+	// user token.
+	apiKeyHeader = "X-API-Key"
 )
 
+// Error codes of the WWW-Authenticate challenge, RFC 6750 section 3.1.
+const (
+	challengeInvalidRequest    = "invalid_request"
+	challengeInvalidToken      = "invalid_token"
+	challengeInsufficientScope = "insufficient_scope"
+)
+
+// b64token is the token syntax of RFC 6750 section 2.1.
+var b64token = regexp.MustCompile(`^[A-Za-z0-9\-._~+/]+=*$`)
+
 func (h *Handler) userIndentity(context *gin.Context) {
+	if apiKey := context.GetHeader(apiKeyHeader); apiKey != "" {
+		h.serviceIdentity(context, apiKey)
+		return
+	}
 	header := context.GetHeader(authorizationHeader)
+	if header == "" && h.legacyAuthHeader {
+		header = context.GetHeader(legacyAuthorizationHeader)
+	}
 	if header == "" {
-		newErrorResponse(context, http.StatusUnauthorized, "empty auth header")
+		bearerChallenge(context, errUnauthorized, "", "empty auth header")
 		return
 	}
-	headerParts := strings.Split(header, " ")
-	if len(headerParts) != 2 {
-		newErrorResponse(context, http.StatusUnauthorized, "invalid auth header")
+	scheme, token, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, bearerScheme) {
+		bearerChallenge(context, errUnauthorized, "", "unsupported auth scheme")
 		return
 	}
-	username, err := h.authservice.Authorize(headerParts[1])
+	if token == "" || strings.ContainsAny(token, " \t") {
+		bearerChallenge(context, errInvalidRequest, challengeInvalidRequest, "invalid auth header")
+		return
+	}
+	if !b64token.MatchString(token) {
+		bearerChallenge(context, errInvalidToken, challengeInvalidToken, "malformed token")
+		return
+	}
+	principal, err := h.authservice.Authorize(context, token)
 	if err != nil {
-		newErrorResponse(context, http.StatusUnauthorized, err.Error())
+		if errors.Is(err, services.ErrInvalidToken) {
+			bearerChallenge(context, errInvalidToken, challengeInvalidToken, services.ErrInvalidToken.Error())
+			return
+		}
+		errorResponse(context, err)
+		return
+	}
+	context.Set(principalCtx, principal)
+	context.Set(tokenCtx, token)
+}
+
+func (h *Handler) serviceIdentity(context *gin.Context, apiKey string) {
+	principal, err := h.apiKeyService.Authenticate(context, apiKey)
+	if err != nil {
+		errorResponse(context, err)
+		return
+	}
+	context.Set(principalCtx, principal)
+}
+
+// requireScope lets through principals that have all of scopes.
+func requireScope(scopes ...string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		principal, ok := principalFrom(context)
+		if !ok {
+			newErrorResponse(context, errUnauthorized, nil)
+			return
+		}
+		for _, scope := range scopes {
+			if principal.HasScope(scope) {
+				continue
+			}
+			if principal.APIKeyId == "" {
+				context.Header("WWW-Authenticate", fmt.Sprintf(`%s realm="%s", error="%s", scope="%s"`,
+					bearerScheme, authRealm, challengeInsufficientScope, strings.Join(scopes, " ")))
+			}
+			newErrorResponse(context, errInsufficientScope, gin.H{"scope": scope})
+			return
+		}
+	}
+}
+
+// principalFrom returns the caller authenticated by userIndentity.
+func principalFrom(context *gin.Context) (*models.Principal, bool) {
+	principal, ok := context.Keys[principalCtx].(*models.Principal)
+	return principal, ok
+}
+
+// bearerChallenge rejects a request without a usable bearer token and tells
+// the client how to authenticate, errorCode is empty when no token was sent.
+func bearerChallenge(context *gin.Context, e apiError, errorCode, message string) {
+	challenge := fmt.Sprintf(`%s realm="%s"`, bearerScheme, authRealm)
+	if errorCode != "" {
+		challenge += fmt.Sprintf(`, error="%s", error_description="%s"`, errorCode, message)
 	}
-	context.Set(userCtx, username)
+	context.Header("WWW-Authenticate", challenge)
+	newErrorResponse(context, e, message)
 }
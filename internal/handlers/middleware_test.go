@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+)
+
+// apiKey creates a service account with a key for scopes.
+func (s *testShop) apiKey(admin, name string, scopes ...string) string {
+	s.t.Helper()
+	if rec := s.do(http.MethodPost, "/api/admin/service-accounts", admin, createServiceAccountRequest{Name: name}); rec.Code != http.StatusCreated {
+		s.t.Fatalf("create service account: %d %s", rec.Code, rec.Body)
+	}
+	rec := s.do(http.MethodPost, "/api/admin/service-accounts/"+name+"/keys", admin, issueAPIKeyRequest{Scopes: scopes})
+	if rec.Code != http.StatusCreated {
+		s.t.Fatalf("issue api key: %d %s", rec.Code, rec.Body)
+	}
+	return decode[issueAPIKeyResponse](s.t, rec).Key
+}
+
+func TestUsersNeedAdminScopes(t *testing.T) {
+	shop := newTestShop(t)
+	user := shop.login("alice")
+	admin := shop.admin("boss")
+	credit := adjustmentRequest{Amount: 5, Reason: "bonus"}
+
+	rec := shop.do(http.MethodPost, "/api/admin/users/alice/credit", user, credit)
+	body := expectError(t, rec, http.StatusForbidden, "insufficient_scope")
+	if details, _ := body.Details.(map[string]interface{}); details["scope"] != models.ScopeCoinsGrant {
+		t.Errorf("details = %v", body.Details)
+	}
+	if challenge := rec.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, `error="insufficient_scope"`) {
+		t.Errorf("WWW-Authenticate = %q", challenge)
+	}
+	expectError(t, shop.do(http.MethodPost, "/api/admin/items", user, createItemRequest{Name: "sticker", Price: intPtr(5)}), http.StatusForbidden, "insufficient_scope")
+
+	if rec := shop.do(http.MethodPost, "/api/admin/users/alice/credit", admin, credit); rec.Code != http.StatusOK {
+		t.Fatalf("admin credit: %d %s", rec.Code, rec.Body)
+	}
+	if coins := shop.info(user).Coins; coins != testWelcomeGrant+5 {
+		t.Errorf("alice has %d coins, want %d", coins, testWelcomeGrant+5)
+	}
+}
+
+func TestRoleChangesApplyToIssuedTokens(t *testing.T) {
+	shop := newTestShop(t)
+	shop.login("alice")
+	admin := shop.admin("boss")
+	credit := adjustmentRequest{Amount: 5, Reason: "bonus"}
+
+	if err := shop.storage.SetUserRole(context.Background(), "boss", models.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	rec := shop.do(http.MethodPost, "/api/admin/users/alice/credit", admin, credit)
+	expectError(t, rec, http.StatusForbidden, "insufficient_scope")
+
+	user := shop.login("alice")
+	if err := shop.storage.SetUserRole(context.Background(), "alice", models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if rec := shop.do(http.MethodPost, "/api/admin/users/boss/credit", user, credit); rec.Code != http.StatusOK {
+		t.Fatalf("promoted user credit: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAPIKeysOnlyGetTheirScopes(t *testing.T) {
+	shop := newTestShop(t)
+	admin := shop.admin("boss")
+	shop.login("alice")
+	key := shop.apiKey(admin, "hr-bot", models.ScopeInfoRead)
+
+	if rec := shop.do(http.MethodGet, "/api/admin/users/alice/info", "", nil, apiKeyHeader, key); rec.Code != http.StatusOK {
+		t.Fatalf("info with info:read: %d %s", rec.Code, rec.Body)
+	}
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/api/items"},
+		{http.MethodGet, "/api/info"},
+		{http.MethodPost, "/api/admin/users/alice/credit"},
+	} {
+		rec := shop.do(route.method, route.path, "", adjustmentRequest{Amount: 5, Reason: "bonus"}, apiKeyHeader, key)
+		expectError(t, rec, http.StatusForbidden, "insufficient_scope")
+		if challenge := rec.Header().Get("WWW-Authenticate"); challenge != "" {
+			t.Errorf("%s %s: bearer challenge %q for an api key", route.method, route.path, challenge)
+		}
+	}
+	expectError(t, shop.do(http.MethodGet, "/api/items", "", nil, apiKeyHeader, key+"x"), http.StatusUnauthorized, "invalid_api_key")
+}
+
+func TestRequestsWithoutCredentialsAreChallenged(t *testing.T) {
+	shop := newTestShop(t)
+	rec := shop.do(http.MethodGet, "/api/info", "", nil)
+	expectError(t, rec, http.StatusUnauthorized, "unauthorized")
+	if challenge := rec.Header().Get("WWW-Authenticate"); !strings.HasPrefix(challenge, bearerScheme) {
+		t.Errorf("WWW-Authenticate = %q", challenge)
+	}
+	expectError(t, shop.do(http.MethodGet, "/api/info", "not-a-jwt", nil), http.StatusUnauthorized, "invalid_token")
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	oidcCookie     = "oidc_login"
+	oidcCookiePath = "/api/auth/oidc"
+	// oidcCookieMaxAge is how many seconds a user has to log in at the provider.
+	oidcCookieMaxAge = 600
+)
+
+// oidcErrors are the error codes an identity provider may redirect back
+// with, RFC 6749 section 4.1.2.1 and OpenID Connect Core section 3.1.2.6.
+// Clients only see these fixed messages, the parameter itself is anyone's
+// to set.
+var oidcErrors = map[string]string{
+	"access_denied":              "the login was denied",
+	"invalid_request":            "the provider rejected the login request",
+	"unauthorized_client":        "the provider rejected the login request",
+	"unsupported_response_type":  "the provider rejected the login request",
+	"invalid_scope":              "the provider rejected the login request",
+	"server_error":               "the provider failed",
+	"temporarily_unavailable":    "the provider is temporarily unavailable",
+	"interaction_required":       "the provider needs the user to log in",
+	"login_required":             "the provider needs the user to log in",
+	"account_selection_required": "the provider needs the user to log in",
+	"consent_required":           "the provider needs the user to log in",
+}
+
+// OIDCLogin redirects to the identity provider. The state, nonce and PKCE
+// verifier of the login are kept in a cookie until the callback.
+func (h *Handler) OIDCLogin(ctx *gin.Context) {
+	login, err := h.oidcService.StartLogin()
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcCookie, strings.Join([]string{login.State, login.Nonce, login.Verifier}, "."),
+		oidcCookieMaxAge, oidcCookiePath, "", h.oidcService.SecureCookies(), true)
+	ctx.Redirect(http.StatusFound, login.URL)
+}
+
+// OIDCCallback finishes the login the provider redirected back from and
+// returns shop tokens like POST /api/auth.
+func (h *Handler) OIDCCallback(ctx *gin.Context) {
+	cookie, err := ctx.Cookie(oidcCookie)
+	if err != nil {
+		newErrorResponse(ctx, errInvalidRequest, "no single sign-on login in progress")
+		return
+	}
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcCookie, "", -1, oidcCookiePath, "", h.oidcService.SecureCookies(), true)
+	parts := strings.Split(cookie, ".")
+	if len(parts) != 3 {
+		newErrorResponse(ctx, errInvalidRequest, "no single sign-on login in progress")
+		return
+	}
+	state, nonce, verifier := parts[0], parts[1], parts[2]
+	if subtle.ConstantTimeCompare([]byte(ctx.Query("state")), []byte(state)) != 1 {
+		newErrorResponse(ctx, errInvalidRequest, "state mismatch")
+		return
+	}
+	if reason := ctx.Query("error"); reason != "" {
+		detail, ok := oidcErrors[reason]
+		if !ok {
+			detail = "the provider returned an unknown error"
+		}
+		newErrorResponse(ctx, errSSOFailed, detail)
+		return
+	}
+	code := ctx.Query("code")
+	if code == "" {
+		newErrorResponse(ctx, errInvalidRequest, "code is required")
+		return
+	}
+	// the token exchange keeps a context derived from this one after the
+	// request, gin reuses its contexts so it gets the request context
+	tokens, err := h.oidcService.FinishLogin(ctx.Request.Context(), code, verifier, nonce)
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, newResponseToken(tokens))
+}
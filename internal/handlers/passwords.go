@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/splashk1e/avito-shop/internal/services"
+)
+
+type changePasswordRequest struct {
+	OldPassword string `json:"oldPassword" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required"`
+}
+
+type passwordResetResponse struct {
+	ResetToken string    `json:"resetToken"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type resetPasswordRequest struct {
+	ResetToken  string `json:"resetToken" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required"`
+}
+
+func (h *Handler) ChangePassword(ctx *gin.Context) {
+	var req changePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		bindErrorResponse(ctx, err)
+		return
+	}
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
+	}
+	// a stolen access token must not allow guessing the password faster
+	// than /api/auth does
+	attempts, err := h.loginGuard.Begin(ctx, caller.Username, ctx.ClientIP())
+	if err != nil {
+		throttledResponse(ctx, err)
+		return
+	}
+	tokens, err := h.authservice.ChangePassword(ctx, caller.Username, req.OldPassword, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			newErrorResponse(ctx, errWrongPassword, nil)
+			return
+		}
+		h.loginGuard.Refund(ctx, attempts)
+		errorResponse(ctx, err)
+		return
+	}
+	h.loginGuard.Succeed(ctx, caller.Username, attempts)
+	ctx.JSON(http.StatusOK, newResponseToken(tokens))
+}
+
+func (h *Handler) IssuePasswordReset(ctx *gin.Context) {
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
+	}
+	token, expiresAt, err := h.authservice.IssuePasswordReset(ctx, caller.Username, ctx.Param("username"))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, passwordResetResponse{ResetToken: token, ExpiresAt: expiresAt})
+}
+
+func (h *Handler) ResetPassword(ctx *gin.Context) {
+	var req resetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		bindErrorResponse(ctx, err)
+		return
+	}
+	if err := h.authservice.ResetPassword(ctx, req.ResetToken, req.NewPassword); err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	ctx.AbortWithStatus(http.StatusNoContent)
+}
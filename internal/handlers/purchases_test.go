@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func (s *testShop) createItem(admin string, item createItemRequest) {
+	s.t.Helper()
+	if rec := s.do(http.MethodPost, "/api/admin/items", admin, item); rec.Code != http.StatusCreated {
+		s.t.Fatalf("create item %s: %d %s", item.Name, rec.Code, rec.Body)
+	}
+}
+
+func (s *testShop) buy(token, item string, quantity int) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.do(http.MethodPost, "/api/buy", token, buyRequest{Item: item, Quantity: &quantity})
+}
+
+func TestBuyReturnsReceipt(t *testing.T) {
+	shop := newTestShop(t)
+	token := shop.login("alice")
+
+	rec := shop.buy(token, "cup", 3)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("buy: %d %s", rec.Code, rec.Body)
+	}
+	receipt := decode[receiptResponse](t, rec)
+	if receipt.Item != "cup" || receipt.Quantity != 3 || receipt.UnitPrice != 20 || receipt.Total != 60 {
+		t.Errorf("receipt = %+v", receipt)
+	}
+	if receipt.Balance != testWelcomeGrant-60 {
+		t.Errorf("receipt balance = %d, want %d", receipt.Balance, testWelcomeGrant-60)
+	}
+	info := shop.info(token)
+	if info.Coins != receipt.Balance {
+		t.Errorf("coins = %d, receipt balance %d", info.Coins, receipt.Balance)
+	}
+	if len(info.Inventory) != 1 || info.Inventory[0] != (InventoryItem{Type: "cup", Quantity: 3}) {
+		t.Errorf("inventory = %+v", info.Inventory)
+	}
+}
+
+func TestBuyWithoutCoinsChangesNothing(t *testing.T) {
+	shop := newTestShop(t)
+	token := shop.login("alice")
+
+	expectError(t, shop.buy(token, "pink-hoody", 3), http.StatusBadRequest, "insufficient_funds")
+	info := shop.info(token)
+	if info.Coins != testWelcomeGrant || len(info.Inventory) != 0 {
+		t.Errorf("after failed purchase coins = %d, inventory = %+v", info.Coins, info.Inventory)
+	}
+}
+
+func TestBuyRespectsPerUserLimitAndStock(t *testing.T) {
+	shop := newTestShop(t)
+	admin := shop.admin("boss")
+	shop.createItem(admin, createItemRequest{Name: "sticker", Price: intPtr(5), Stock: intPtr(3), PerUserLimit: intPtr(2)})
+	alice := shop.login("alice")
+	bob := shop.login("bob")
+
+	if rec := shop.buy(alice, "sticker", 2); rec.Code != http.StatusOK {
+		t.Fatalf("buy up to the limit: %d %s", rec.Code, rec.Body)
+	}
+	expectError(t, shop.buy(alice, "sticker", 1), http.StatusForbidden, "limit_reached")
+	expectError(t, shop.buy(bob, "sticker", 2), http.StatusConflict, "sold_out")
+	if rec := shop.buy(bob, "sticker", 1); rec.Code != http.StatusOK {
+		t.Fatalf("buy the last one: %d %s", rec.Code, rec.Body)
+	}
+	expectError(t, shop.buy(bob, "sticker", 1), http.StatusConflict, "sold_out")
+
+	item := decode[itemResponse](t, shop.do(http.MethodGet, "/api/items/sticker", alice, nil))
+	if item.Stock == nil || *item.Stock != 0 {
+		t.Errorf("stock = %v, want 0", item.Stock)
+	}
+}
+
+func TestConcurrentPurchasesDontOversell(t *testing.T) {
+	const buyers, stock = 8, 3
+	shop := newTestShop(t)
+	admin := shop.admin("boss")
+	shop.createItem(admin, createItemRequest{Name: "sticker", Price: intPtr(5), Stock: intPtr(stock)})
+	tokens := make([]string, buyers)
+	for i := range tokens {
+		tokens[i] = shop.login(fmt.Sprintf("buyer%d", i))
+	}
+
+	codes := make(chan int, buyers)
+	var wg sync.WaitGroup
+	for _, token := range tokens {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			codes <- shop.buy(token, "sticker", 1).Code
+		}(token)
+	}
+	wg.Wait()
+	close(codes)
+	bought := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			bought++
+		case http.StatusConflict:
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if bought != stock {
+		t.Errorf("%d purchases succeeded, want %d", bought, stock)
+	}
+}
+
+func TestRetiredItemCantBeBought(t *testing.T) {
+	shop := newTestShop(t)
+	admin := shop.admin("boss")
+	token := shop.login("alice")
+	if rec := shop.do(http.MethodPost, "/api/admin/items/cup/retire", admin, nil); rec.Code >= 300 {
+		t.Fatalf("retire: %d %s", rec.Code, rec.Body)
+	}
+	expectError(t, shop.buy(token, "cup", 1), http.StatusConflict, "item_retired")
+	if rec := shop.do(http.MethodPost, "/api/admin/items/cup/restore", admin, nil); rec.Code >= 300 {
+		t.Fatalf("restore: %d %s", rec.Code, rec.Body)
+	}
+	if rec := shop.buy(token, "cup", 1); rec.Code != http.StatusOK {
+		t.Fatalf("buy restored item: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestItemsNeedAPositivePrice(t *testing.T) {
+	shop := newTestShop(t)
+	admin := shop.admin("boss")
+	for _, price := range []*int{nil, intPtr(0), intPtr(-5)} {
+		rec := shop.do(http.MethodPost, "/api/admin/items", admin, createItemRequest{Name: "sticker", Price: price})
+		expectError(t, rec, http.StatusBadRequest, "invalid_price")
+	}
+	shop.createItem(admin, createItemRequest{Name: "sticker", Price: intPtr(5)})
+	rec := shop.do(http.MethodPatch, "/api/admin/items/sticker", admin, map[string]int{"price": 0})
+	expectError(t, rec, http.StatusBadRequest, "invalid_price")
+}
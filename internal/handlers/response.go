@@ -1,16 +1,126 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/splashk1e/avito-shop/internal/lib/logger/sl"
 )
 
+const (
+	requestIdHeader = "X-Request-Id"
+	requestIdCtx    = "request_id"
+	loggerCtx       = "logger"
+)
+
+// validRequestId limits the request ids accepted from clients, so they can
+// be echoed and logged safely.
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
 type Error struct {
-	Message string `json:"errors"`
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestId string      `json:"request_id"`
+}
+
+// newErrorResponse aborts the request with e. Details are shown to clients
+// as they are and must not contain internal errors.
+func newErrorResponse(context *gin.Context, e apiError, details interface{}) {
+	requestId := context.GetString(requestIdCtx)
+	logger(context).Info("request failed", slog.String("code", e.code))
+	status := e.status
+	if overrides, ok := specRoutes[context.FullPath()]; ok {
+		status = specStatus(e, overrides)
+	}
+	context.AbortWithStatusJSON(status, Error{
+		Code:      e.code,
+		Message:   e.message,
+		Details:   details,
+		RequestId: requestId,
+	})
+}
+
+// bindErrorResponse rejects a request body that can't be bound. The binding
+// error names Go types and struct fields, so it is only logged.
+func bindErrorResponse(context *gin.Context, err error) {
+	logger(context).Info("invalid request body", sl.Err(err))
+	newErrorResponse(context, errInvalidRequest, "body must be a JSON object with the documented fields")
+}
+
+// specRoutes are the routes of the Avito API spec, which only documents
+// 400, 401 and 500 for failed requests. Their errors keep the catalogue
+// code but not its status, the map holds the codes answered otherwise
+// than 400.
+var specRoutes = map[string]map[string]int{
+	"/api/auth":     nil,
+	"/api/info":     nil,
+	"/api/sendCoin": nil,
+	// the only user a purchase looks up is the caller
+	"/api/buy/:item": {"user_not_found": http.StatusUnauthorized},
+}
+
+// specStatus is the status of e on a spec route. Lockouts keep 429 with
+// Retry-After, errors of opt-in features like idempotency keys and scoped
+// API keys keep their own status.
+func specStatus(e apiError, overrides map[string]int) int {
+	if status, ok := overrides[e.code]; ok {
+		return status
+	}
+	switch {
+	case e.status == http.StatusUnauthorized, e.status >= http.StatusInternalServerError:
+		return e.status
+	case e == errInsufficientScope, e.code == "too_many_attempts", strings.HasPrefix(e.code, "idempotency_key_"):
+		return e.status
+	}
+	return http.StatusBadRequest
+}
+
+// errorResponse aborts the request with the catalogue entry of err. Errors
+// missing from the catalogue are logged and answered as internal errors.
+func errorResponse(context *gin.Context, err error) {
+	e, detail, ok := lookupError(err)
+	if !ok {
+		logger(context).Error("internal error", sl.Err(err))
+		newErrorResponse(context, errInternal, nil)
+		return
+	}
+	if detail == "" {
+		newErrorResponse(context, e, nil)
+		return
+	}
+	newErrorResponse(context, e, detail)
+}
+
+// requestId tags the request with the X-Request-Id of the client or a new
+// one, it is sent back, included in error responses and in what the
+// handlers log about the request.
+func (h *Handler) requestId(context *gin.Context) {
+	id := context.GetHeader(requestIdHeader)
+	if !validRequestId.MatchString(id) {
+		b := make([]byte, 16)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	context.Set(requestIdCtx, id)
+	context.Set(loggerCtx, h.log.With(slog.String("request_id", id)))
+	context.Header(requestIdHeader, id)
+}
+
+// logger returns the logger of the request set by requestId.
+func logger(context *gin.Context) *slog.Logger {
+	return context.MustGet(loggerCtx).(*slog.Logger)
+}
+
+func noRoute(context *gin.Context) {
+	newErrorResponse(context, errNotFound, nil)
 }
 
-func newErrorResponse(context *gin.Context, statusCode int, message string) {
-	slog.Error(message)
-	context.AbortWithStatusJSON(statusCode, Error{message})
+func noMethod(context *gin.Context) {
+	newErrorResponse(context, errNotAllowed, nil)
 }
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/splashk1e/avito-shop/internal/models"
+)
+
+type transactionResponse struct {
+	Id        int       `json:"id"`
+	Type      string    `json:"type"`
+	FromUser  string    `json:"fromUser"`
+	ToUser    string    `json:"toUser"`
+	Amount    int       `json:"amount"`
+	Item      string    `json:"item,omitempty"`
+	Quantity  int       `json:"quantity,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Actor     string    `json:"actor,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+type transactionsResponse struct {
+	Transactions []transactionResponse `json:"transactions"`
+	NextCursor   string                `json:"nextCursor,omitempty"`
+}
+
+func (h *Handler) ListTransactions(ctx *gin.Context) {
+	caller, ok := principalFrom(ctx)
+	if !ok {
+		newErrorResponse(ctx, errUnauthorized, nil)
+		return
+	}
+	filter := models.TransactionFilter{
+		Username:     caller.Username,
+		Direction:    ctx.Query("direction"),
+		Counterparty: ctx.Query("counterparty"),
+		Item:         ctx.Query("item"),
+	}
+	var err error
+	if filter.From, err = parseTimeQuery(ctx, "from"); err != nil {
+		newErrorResponse(ctx, errInvalidRequest, "invalid from")
+		return
+	}
+	if filter.To, err = parseTimeQuery(ctx, "to"); err != nil {
+		newErrorResponse(ctx, errInvalidRequest, "invalid to")
+		return
+	}
+	if limit := ctx.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			newErrorResponse(ctx, errInvalidRequest, "invalid limit")
+			return
+		}
+	}
+	page, err := h.transactionService.ListTransactions(ctx, filter, ctx.Query("cursor"))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	response := transactionsResponse{
+		Transactions: make([]transactionResponse, 0, len(page.Transactions)),
+		NextCursor:   page.NextCursor,
+	}
+	for _, val := range page.Transactions {
+		response.Transactions = append(response.Transactions, newTransactionResponse(caller.Username, val))
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func newTransactionResponse(username string, transaction models.Transaction) transactionResponse {
+	response := transactionResponse{
+		Id:        transaction.Id,
+		FromUser:  transaction.Sender,
+		ToUser:    transaction.Reciever,
+		Amount:    transaction.Amount,
+		CreatedAt: transaction.CreatedAt,
+		Actor:     transaction.Actor,
+		Reason:    transaction.Reason,
+	}
+	switch {
+	case transaction.Item != "":
+		response.Type = models.DirectionPurchase
+		response.Item = transaction.Item
+		response.Quantity = transaction.Quantity
+	case transaction.Sender == username:
+		response.Type = models.DirectionSent
+	default:
+		response.Type = models.DirectionReceived
+	}
+	return response
+}
+
+func parseTimeQuery(ctx *gin.Context, key string) (time.Time, error) {
+	value := ctx.Query(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -1,6 +1,8 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -8,42 +10,85 @@ import (
 	"github.com/splashk1e/avito-shop/internal/models"
 )
 
-func NewToken(user models.User, duration time.Duration, secret string) (string, error) {
+type Claims struct {
+	// Id is the unique token id (jti) used to revoke a single token.
+	Id string
+	// SessionId is the session (sid) the token was issued for.
+	SessionId string
+	UserId    int
+	Username  string
+	Role      string
+	ExpiresAt time.Time
+}
+
+// NewToken signs an access token for user with the signing key of the set.
+func (k *KeySet) NewToken(user models.User, sessionId string, duration time.Duration) (string, error) {
 	const op = "jwt.NewToken"
-	token := jwt.New(jwt.SigningMethodHS256)
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	token := jwt.New(k.signing.method)
+	if k.signing.Id != "" {
+		token.Header["kid"] = k.signing.Id
+	}
 	claims := token.Claims.(jwt.MapClaims)
+	claims["jti"] = hex.EncodeToString(jti)
+	claims["sid"] = sessionId
 	claims["uid"] = user.Id
 	claims["username"] = user.Username
+	claims["role"] = user.Role
 	claims["exp"] = time.Now().Add(duration).Unix()
 
-	tokenString, err := token.SignedString(claims)
+	tokenString, err := token.SignedString(k.signing.signKey)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 	return tokenString, nil
 }
 
-func ParseToken(tokenString string, secret string) (username string, err error) {
+// ParseToken verifies tokenString with the key named by its kid header and
+// returns its claims.
+func (k *KeySet) ParseToken(tokenString string) (*Claims, error) {
 	const op = "jwt.ParseToken"
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(secret), nil
+		return key.verifyKey, nil
 	})
 
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		username, ok := claims["username"].(string)
-		if !ok {
-			return "", fmt.Errorf("%s: wrong jwt token", op)
-		}
-		return username, nil
-
-	} else {
-		return "", fmt.Errorf("%s: %w", op, err)
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("%s: invalid jwt token", op)
+	}
+	username, ok := claims["username"].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s: wrong jwt token", op)
+	}
+	uid, _ := claims["uid"].(float64)
+	role, ok := claims["role"].(string)
+	if !ok {
+		role = models.RoleUser
 	}
+	jti, _ := claims["jti"].(string)
+	sid, _ := claims["sid"].(string)
+	exp, _ := claims["exp"].(float64)
+	return &Claims{
+		Id:        jti,
+		SessionId: sid,
+		UserId:    int(uid),
+		Username:  username,
+		Role:      role,
+		ExpiresAt: time.Unix(int64(exp), 0),
+	}, nil
 }
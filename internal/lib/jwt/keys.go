@@ -0,0 +1,139 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Key is one signing or verification key. Keys loaded without a private key
+// can only verify tokens, they are kept around while old tokens expire
+// after a rotation.
+type Key struct {
+	Id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet signs tokens with one key and verifies them with any key of the set.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewHMACKeySet returns a set with a single HS256 secret and no key id.
+func NewHMACKeySet(secret string) (*KeySet, error) {
+	if secret == "" {
+		return nil, errors.New("jwt: empty hmac secret")
+	}
+	key := &Key{
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+	return &KeySet{signing: key, keys: map[string]*Key{"": key}}, nil
+}
+
+// NewKeySet returns a set that signs with the key named signingKeyId and
+// verifies with all of keys.
+func NewKeySet(signingKeyId string, keys ...*Key) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if key.Id == "" {
+			return nil, errors.New("jwt: key id is required")
+		}
+		if _, ok := set.keys[key.Id]; ok {
+			return nil, fmt.Errorf("jwt: duplicate key id %q", key.Id)
+		}
+		set.keys[key.Id] = key
+	}
+	signing, ok := set.keys[signingKeyId]
+	if !ok {
+		return nil, fmt.Errorf("jwt: signing key %q not found", signingKeyId)
+	}
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("jwt: signing key %q has no private key", signingKeyId)
+	}
+	set.signing = signing
+	return set, nil
+}
+
+// LoadKey reads a PEM encoded key pair for algorithm. When privateKeyPath is
+// set the public key is derived from it, otherwise publicKeyPath is read and
+// the key can only verify tokens.
+func LoadKey(id, algorithm, privateKeyPath, publicKeyPath string) (*Key, error) {
+	const op = "jwt.LoadKey"
+	key := &Key{Id: id}
+	switch algorithm {
+	case AlgorithmRS256:
+		key.method = jwt.SigningMethodRS256
+	case AlgorithmEdDSA:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%s: key %q: unsupported algorithm %q", op, id, algorithm)
+	}
+	var err error
+	switch {
+	case privateKeyPath != "":
+		key.signKey, key.verifyKey, err = loadPrivateKey(algorithm, privateKeyPath)
+	case publicKeyPath != "":
+		key.verifyKey, err = loadPublicKey(algorithm, publicKeyPath)
+	default:
+		err = errors.New("private or public key path is required")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: key %q: %w", op, id, err)
+	}
+	return key, nil
+}
+
+func loadPrivateKey(algorithm, path string) (crypto.PrivateKey, crypto.PublicKey, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if algorithm == AlgorithmRS256 {
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &key.PublicKey, nil
+	}
+	key, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+	if err != nil {
+		return nil, nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("not an ed25519 private key")
+	}
+	return edKey, edKey.Public(), nil
+}
+
+func loadPublicKey(algorithm, path string) (crypto.PublicKey, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == AlgorithmRS256 {
+		return jwt.ParseRSAPublicKeyFromPEM(pem)
+	}
+	key, err := jwt.ParseEdPublicKeyFromPEM(pem)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := key.(ed25519.PublicKey); !ok {
+		return nil, errors.New("not an ed25519 public key")
+	}
+	return key, nil
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// APIKey is a credential of a service account. Only the hash of the secret
+// part is stored.
+type APIKey struct {
+	Id             string
+	ServiceAccount string
+	KeyHash        string
+	Scopes         []string
+	CreatedBy      string
+	CreatedAt      time.Time
+	// ExpiresAt is nil for keys that don't expire.
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	Revoked    bool
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// LoginAttempts counts the recent failed logins for a username or a client IP.
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// LoginAttempt is a login counted as failed before the password is checked,
+// it is refunded when the login turns out not to be a wrong guess.
+type LoginAttempt struct {
+	Key string
+	At  time.Time
+	// PreviousFailure is the LastFailure of the counter before the attempt.
+	PreviousFailure time.Time
+}
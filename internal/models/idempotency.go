@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// IdempotencyKey is a client supplied key remembered together with the
+// request it was first used with. StatusCode is zero while the original
+// request is still being processed.
+type IdempotencyKey struct {
+	Username    string
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	Response    []byte
+	CreatedAt   time.Time
+	// Attempt counts the reservations of the key, it grows when a stale
+	// reservation is taken over so the old request can't use the key anymore.
+	Attempt int
+	// TransactionId is the transaction the request posted, it is set in the
+	// same database transaction, zero while nothing was posted.
+	TransactionId int
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ExternalIdentity is a user as asserted by an OpenID Connect provider.
+type ExternalIdentity struct {
+	Issuer            string
+	Subject           string
+	PreferredUsername string
+	Email             string
+}
+
+// UserIdentity links the subject of an identity provider to a shop user.
+type UserIdentity struct {
+	Issuer    string
+	Subject   string
+	Username  string
+	CreatedAt time.Time
+}
@@ -0,0 +1,6 @@
+package models
+
+type InventoryItem struct {
+	Type     string
+	Quantity int
+}
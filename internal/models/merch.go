@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// MerchItem is a catalog item. A nil Stock or PerUserLimit means the item
+// is not limited.
+type MerchItem struct {
+	Id           int
+	Name         string
+	Price        int
+	Description  string
+	Available    bool
+	Stock        *int
+	PerUserLimit *int
+}
+
+// MerchItemPrice is one version of an item price, valid from ValidFrom until
+// the next version. ChangedBy is empty for the initial catalog prices.
+type MerchItemPrice struct {
+	Price     int
+	ValidFrom time.Time
+	ChangedBy string
+}
@@ -0,0 +1,75 @@
+package models
+
+import "slices"
+
+// Scopes are what a principal may do. Users get the scopes of their roles,
+// service accounts the scopes of their API key.
+const (
+	// ScopeAccount allows acting as oneself: buying merch, sending coins
+	// and reading one's own balance and history.
+	ScopeAccount      = "account"
+	ScopeCatalogRead  = "catalog:read"
+	ScopeCatalogWrite = "catalog:write"
+	ScopeCoinsGrant   = "coins:grant"
+	ScopeCoinsDebit   = "coins:debit"
+	// ScopeInfoRead allows reading the balance and history of any user.
+	ScopeInfoRead = "info:read"
+	// ScopeUsersManage allows password resets and managing service accounts.
+	ScopeUsersManage = "users:manage"
+)
+
+var roleScopes = map[string][]string{
+	RoleUser: {ScopeAccount, ScopeCatalogRead},
+	RoleAdmin: {ScopeAccount, ScopeCatalogRead, ScopeCatalogWrite, ScopeCoinsGrant, ScopeCoinsDebit,
+		ScopeInfoRead, ScopeUsersManage},
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserId   int
+	Username string
+	Roles    []string
+	Scopes   []string
+	// APIKeyId is set when the principal authenticated with an API key.
+	APIKeyId string
+}
+
+// NewUserPrincipal returns the principal of a user logged in with a token.
+// Admins are users too and get the scopes of both roles.
+func NewUserPrincipal(user User) *Principal {
+	roles := []string{user.Role}
+	if user.Role == RoleAdmin {
+		roles = []string{RoleUser, RoleAdmin}
+	}
+	var scopes []string
+	for _, role := range roles {
+		scopes = append(scopes, roleScopes[role]...)
+	}
+	slices.Sort(scopes)
+	return &Principal{
+		UserId:   user.Id,
+		Username: user.Username,
+		Roles:    roles,
+		Scopes:   slices.Compact(scopes),
+	}
+}
+
+// NewServicePrincipal returns the principal of a service account calling
+// with key.
+func NewServicePrincipal(account User, key APIKey) *Principal {
+	return &Principal{
+		UserId:   account.Id,
+		Username: account.Username,
+		Roles:    []string{RoleService},
+		Scopes:   key.Scopes,
+		APIKeyId: key.Id,
+	}
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Session is one login of a user. It is extended by exchanging its refresh
+// token, only the SHA-256 hash of the current refresh token is stored.
+type Session struct {
+	Id          string
+	Username    string
+	RefreshHash string
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+	Revoked     bool
+}
+
+// TokenPair is what a client gets on login and on refresh.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// PasswordReset is a one-time token an admin issued to let username set a
+// new password. Only the SHA-256 hash of the token is stored.
+type PasswordReset struct {
+	TokenHash string
+	Username  string
+	CreatedBy string
+	ExpiresAt time.Time
+	Used      bool
+}
@@ -1,9 +1,71 @@
 package models
 
+import "time"
+
 type Transaction struct {
-	Id       int
-	Reciever string
-	Sender   string
-	Amount   int
-	Item     string
+	Id        int
+	Reciever  string
+	Sender    string
+	Amount    int
+	Item      string
+	Quantity  int
+	CreatedAt time.Time
+	// Actor is the admin who made a manual balance adjustment and Reason
+	// explains it, both are empty for regular transfers and purchases.
+	Actor  string
+	Reason string
+	// IdempotencyKey is the reserved key of the request posting the
+	// transaction, the key is marked with the transaction id in the same
+	// database transaction. It is only used when saving and may be nil.
+	IdempotencyKey *IdempotencyKey
+}
+
+type Receipt struct {
+	TransactionId int
+	Item          string
+	Quantity      int
+	UnitPrice     int
+	Total         int
+	Balance       int
+}
+
+// CoinTransfer is the total amount of coins moved between a user and one counterparty.
+type CoinTransfer struct {
+	User   string
+	Amount int
+}
+
+type CoinHistory struct {
+	Received []CoinTransfer
+	Sent     []CoinTransfer
+}
+
+const (
+	DirectionSent     = "sent"
+	DirectionReceived = "received"
+	DirectionPurchase = "purchase"
+)
+
+// TransactionFilter selects a page of a user's transactions ordered from the
+// newest to the oldest. Zero values disable the corresponding filter.
+type TransactionFilter struct {
+	Username     string
+	Direction    string
+	Counterparty string
+	Item         string
+	From         time.Time
+	To           time.Time
+	After        *TransactionCursor
+	Limit        int
+}
+
+// TransactionCursor points at the last transaction of the previous page.
+type TransactionCursor struct {
+	CreatedAt time.Time
+	Id        int
+}
+
+type TransactionPage struct {
+	Transactions []Transaction
+	NextCursor   string
 }
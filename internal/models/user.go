@@ -1,10 +1,19 @@
 package models
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+	// RoleService is the role of service accounts, they authenticate with
+	// API keys and can't log in with a password.
+	RoleService = "service"
+)
+
 type User struct {
 	Id        int
 	Username  string
 	PassHash  string
 	Coins     int
+	Role      string
 	recieved  []Transaction
 	sent      []Transaction
 	Inventory []string
@@ -10,17 +10,20 @@ type Server struct {
 	httpServer *http.Server
 }
 
-func (s *Server) Run(port string, handler http.Handler) error {
+func (s *Server) Run(port string, timeout time.Duration, handler http.Handler) error {
 	s.httpServer = &http.Server{
 		Addr:           "localhost" + port,
 		Handler:        handler,
 		MaxHeaderBytes: 1 << 20,
-		ReadTimeout:    100 * time.Millisecond,
-		WriteTimeout:   100 * time.Millisecond,
+		ReadTimeout:    timeout,
+		WriteTimeout:   timeout,
 	}
 	return s.httpServer.ListenAndServe()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.httpServer == nil {
+		return nil
+	}
 	return s.httpServer.Shutdown(ctx)
 }
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/lib/logger/sl"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+// APIKeyService manages service accounts and the API keys they use for
+// machine to machine calls.
+type APIKeyService struct {
+	log          *slog.Logger
+	apiKeys      APIKeyStore
+	userProvider UserProvider
+}
+
+type APIKeyStore interface {
+	SaveServiceAccount(ctx context.Context, name string) (int, error)
+	SaveAPIKey(ctx context.Context, key models.APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, serviceAccount string) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, serviceAccount, id string) error
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+}
+
+var (
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrAPIKeyNotFound         = errors.New("api key not found")
+	ErrInvalidAPIKey          = errors.New("invalid api key")
+	ErrInvalidScope           = errors.New("unknown or missing scope")
+	ErrInvalidExpiry          = errors.New("expiry must not be negative")
+)
+
+// Scopes are all scopes an API key can be issued with. Service accounts
+// can't act as a shop user or manage other accounts.
+var Scopes = []string{
+	models.ScopeCatalogRead,
+	models.ScopeCatalogWrite,
+	models.ScopeCoinsGrant,
+	models.ScopeCoinsDebit,
+	models.ScopeInfoRead,
+}
+
+const (
+	apiKeyPrefix = "ak_"
+	// lastUsedResolution limits last used updates to one write per key and
+	// interval, instead of one per request.
+	lastUsedResolution = time.Minute
+)
+
+func NewAPIKeyService(apiKeys APIKeyStore, userProvider UserProvider, log *slog.Logger) *APIKeyService {
+	return &APIKeyService{
+		log:          log,
+		apiKeys:      apiKeys,
+		userProvider: userProvider,
+	}
+}
+
+// CreateServiceAccount creates an account without a password that can
+// only be used with API keys.
+func (s *APIKeyService) CreateServiceAccount(ctx context.Context, actor, name string) error {
+	const op = "services.apikeys.CreateServiceAccount"
+	log := s.log.With(slog.String("op", op))
+	log.Info("creating service account", slog.String("actor", actor), slog.String("name", name))
+	if err := validateUsername(name); err != nil || storage.IsSystemAccount(name) {
+		return fmt.Errorf("%s %w", op, ErrInvalidUsername)
+	}
+	if _, err := s.apiKeys.SaveServiceAccount(ctx, name); err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			return fmt.Errorf("%s %w", op, ErrUserExists)
+		}
+		log.Error("failed to save service account", sl.Err(err))
+		return fmt.Errorf("%s %w", op, err)
+	}
+	return nil
+}
+
+// IssueAPIKey creates a key for serviceAccount with scopes. The returned
+// key is shown once, only its hash is stored. A zero ttl never expires.
+func (s *APIKeyService) IssueAPIKey(ctx context.Context, actor, serviceAccount string, scopes []string, ttl time.Duration) (string, *models.APIKey, error) {
+	const op = "services.apikeys.IssueAPIKey"
+	log := s.log.With(slog.String("op", op))
+	log.Info("issuing api key", slog.String("actor", actor), slog.String("service_account", serviceAccount))
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("%s %w", op, ErrInvalidScope)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return "", nil, fmt.Errorf("%s %w", op, withDetail(ErrInvalidScope, "%q", scope))
+		}
+	}
+	if ttl < 0 {
+		return "", nil, fmt.Errorf("%s %w", op, ErrInvalidExpiry)
+	}
+	if err := s.checkServiceAccount(ctx, serviceAccount); err != nil {
+		return "", nil, fmt.Errorf("%s %w", op, err)
+	}
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, fmt.Errorf("%s %w", op, err)
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s %w", op, err)
+	}
+	id := hex.EncodeToString(idBytes)
+	token := apiKeyPrefix + id + "." + secret
+	key := models.APIKey{
+		Id:             id,
+		ServiceAccount: serviceAccount,
+		KeyHash:        hashToken(token),
+		Scopes:         normalizeScopes(scopes),
+		CreatedBy:      actor,
+		CreatedAt:      time.Now(),
+	}
+	if ttl > 0 {
+		expiresAt := key.CreatedAt.Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.apiKeys.SaveAPIKey(ctx, key); err != nil {
+		log.Error("failed to save api key", sl.Err(err))
+		return "", nil, fmt.Errorf("%s %w", op, err)
+	}
+	return token, &key, nil
+}
+
+func (s *APIKeyService) ListAPIKeys(ctx context.Context, serviceAccount string) ([]models.APIKey, error) {
+	const op = "services.apikeys.ListAPIKeys"
+	if err := s.checkServiceAccount(ctx, serviceAccount); err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	keys, err := s.apiKeys.ListAPIKeys(ctx, serviceAccount)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return keys, nil
+}
+
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, actor, serviceAccount, id string) error {
+	const op = "services.apikeys.RevokeAPIKey"
+	log := s.log.With(slog.String("op", op))
+	log.Info("revoking api key", slog.String("actor", actor), slog.String("id", id))
+	if err := s.apiKeys.RevokeAPIKey(ctx, serviceAccount, id); err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			return fmt.Errorf("%s %w", op, ErrAPIKeyNotFound)
+		}
+		return fmt.Errorf("%s %w", op, err)
+	}
+	return nil
+}
+
+// Authenticate checks an API key and returns the principal of its service
+// account, recording when the key was last used.
+func (s *APIKeyService) Authenticate(ctx context.Context, token string) (*models.Principal, error) {
+	const op = "services.apikeys.Authenticate"
+	log := s.log.With(slog.String("op", op))
+	id, _, ok := strings.Cut(strings.TrimPrefix(token, apiKeyPrefix), ".")
+	if !ok || !strings.HasPrefix(token, apiKeyPrefix) {
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidAPIKey)
+	}
+	key, err := s.apiKeys.GetAPIKey(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			return nil, fmt.Errorf("%s %w", op, ErrInvalidAPIKey)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(key.KeyHash)) != 1 {
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidAPIKey)
+	}
+	now := time.Now()
+	if key.Revoked || (key.ExpiresAt != nil && !key.ExpiresAt.After(now)) {
+		log.Warn("revoked or expired api key used", slog.String("id", key.Id))
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidAPIKey)
+	}
+	account, err := s.userProvider.GetUser(ctx, key.ServiceAccount)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s %w", op, ErrInvalidAPIKey)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	if account.Role != models.RoleService {
+		log.Warn("api key of a non service account used", slog.String("id", key.Id))
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidAPIKey)
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		if err := s.apiKeys.TouchAPIKey(ctx, key.Id, now); err != nil {
+			log.Error("failed to record api key use", sl.Err(err))
+		}
+	}
+	return models.NewServicePrincipal(*account, *key), nil
+}
+
+func (s *APIKeyService) checkServiceAccount(ctx context.Context, name string) error {
+	user, err := s.userProvider.GetUser(ctx, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrServiceAccountNotFound
+		}
+		return err
+	}
+	if user.Role != models.RoleService {
+		return ErrServiceAccountNotFound
+	}
+	return nil
+}
+
+// normalizeScopes sorts scopes and drops duplicates.
+func normalizeScopes(scopes []string) []string {
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+	return slices.Compact(scopes)
+}
@@ -2,12 +2,20 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/splashk1e/avito-shop/internal/lib/jwt"
+	"github.com/splashk1e/avito-shop/internal/lib/logger/sl"
 	"github.com/splashk1e/avito-shop/internal/models"
 	"github.com/splashk1e/avito-shop/internal/storage"
 	"golang.org/x/crypto/bcrypt"
@@ -16,90 +24,336 @@ import (
 type AuthService struct {
 	userSaver        UserSaver
 	userProvider     UserProvider
-	transactionSaver TransactionSaver
+	sessionStore     SessionStore
+	passwordResets   PasswordResetStore
 	log              *slog.Logger
 	TokenTTL         time.Duration
-	secret           string
+	RefreshTokenTTL  time.Duration
+	PasswordResetTTL time.Duration
+	keys             *jwt.KeySet
+	welcomeGrant     int
+	registration     RegistrationPolicy
 }
 
 type UserSaver interface {
-	SaveUser(ctx context.Context, username string, passHash []byte) (int, error)
+	// SaveUser creates a user with welcomeGrant coins from the bank, both in
+	// one transaction.
+	SaveUser(ctx context.Context, username string, passHash []byte, welcomeGrant int) (int, error)
+	SetUserRole(ctx context.Context, username, role string) error
+	SetUserPassword(ctx context.Context, username string, passHash []byte) error
 }
 
 type UserProvider interface {
 	GetUser(ctx context.Context, username string) (*models.User, error)
 }
 
-func NewAuthService(log *slog.Logger, userSaver UserSaver, userProvider UserProvider, TokenTTL time.Duration, secret string) *AuthService {
+type SessionStore interface {
+	SaveSession(ctx context.Context, session models.Session) error
+	GetSession(ctx context.Context, id string) (*models.Session, error)
+	RotateSession(ctx context.Context, id, refreshHash, newRefreshHash string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, id string) error
+	RevokeUserSessions(ctx context.Context, username string) error
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsTokenRevoked reports whether the token jti or its session is revoked.
+	IsTokenRevoked(ctx context.Context, jti, sessionId string) (bool, error)
+}
+
+func NewAuthService(log *slog.Logger, userSaver UserSaver, userProvider UserProvider, sessionStore SessionStore, passwordResets PasswordResetStore, TokenTTL, RefreshTokenTTL, PasswordResetTTL time.Duration, keys *jwt.KeySet, welcomeGrant int, registration RegistrationPolicy) *AuthService {
 	return &AuthService{
-		log:          log,
-		userSaver:    userSaver,
-		userProvider: userProvider,
-		TokenTTL:     TokenTTL,
-		secret:       secret,
+		log:              log,
+		userSaver:        userSaver,
+		userProvider:     userProvider,
+		sessionStore:     sessionStore,
+		passwordResets:   passwordResets,
+		TokenTTL:         TokenTTL,
+		RefreshTokenTTL:  RefreshTokenTTL,
+		PasswordResetTTL: PasswordResetTTL,
+		keys:             keys,
+		welcomeGrant:     welcomeGrant,
+		registration:     registration,
 	}
 }
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidToken       = errors.New("invalid or expired token")
 )
 
-func (a *AuthService) Login(ctx context.Context, username string, password string) (string, error) {
+// Login checks the password of username and starts a new session. Unknown
+// users are registered when the policy allows auto-registration.
+func (a *AuthService) Login(ctx context.Context, username string, password string) (*models.TokenPair, error) {
 	const op = "services.auth.Login"
 	log := a.log.With(slog.String("op", op))
 	log.Info("Logining user")
 	user, err := a.userProvider.GetUser(ctx, username)
 	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			if _, err := a.Register(ctx, username, password); err != nil {
-				return "", fmt.Errorf("%s %w", op, err)
+		if !errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s %w", op, err)
+		}
+		if !a.registration.AutoRegister {
+			// Compare anyway so unknown users can't be told apart by timing.
+			bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+			log.Info("user not found")
+			return nil, fmt.Errorf("%s %w", op, ErrInvalidCredentials)
+		}
+		// A concurrent login may have registered the user first. The
+		// username and password policy only applies to Register, the Avito
+		// spec lets any credentials register.
+		if _, err := a.createUser(ctx, username, password); err != nil && !errors.Is(err, ErrUserExists) {
+			if errors.Is(err, ErrInvalidUsername) {
+				return nil, fmt.Errorf("%s %w", op, ErrInvalidCredentials)
 			}
+			return nil, fmt.Errorf("%s %w", op, err)
+		}
+		if user, err = a.userProvider.GetUser(ctx, username); err != nil {
+			return nil, fmt.Errorf("%s %w", op, err)
 		}
-		return "", fmt.Errorf("%s %w", op, err)
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PassHash), []byte(password)); err != nil {
-		log.Info("invalid password", err.Error())
-		return "", fmt.Errorf("%s %w", op, ErrInvalidCredentials)
+		log.Info("invalid password", sl.Err(err))
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidCredentials)
 	}
-	token, err := jwt.NewToken(*user, a.TokenTTL, a.secret)
+	tokens, err := a.startSession(ctx, *user)
 	if err != nil {
-		log.Error("failed to generate token", err.Error())
-		return "", fmt.Errorf("%s %w", op, err)
+		log.Error("failed to start session", sl.Err(err))
+		return nil, fmt.Errorf("%s %w", op, err)
 	}
-	return token, nil
+	return tokens, nil
 }
 
-func (a *AuthService) Register(ctx context.Context, username string, password string) (int, error) {
-	const op = "services.auth.RegisterNewUser"
+// Refresh exchanges a refresh token for a new token pair. The refresh token
+// is rotated, presenting an already used one revokes the whole session.
+func (a *AuthService) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	const op = "services.auth.Refresh"
+	log := a.log.With(slog.String("op", op))
+	log.Info("refreshing session")
+	sessionId, _, ok := strings.Cut(refreshToken, ".")
+	if !ok {
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidToken)
+	}
+	session, err := a.sessionStore.GetSession(ctx, sessionId)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return nil, fmt.Errorf("%s %w", op, ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	if session.Revoked || !session.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidToken)
+	}
+	refreshHash := hashToken(refreshToken)
+	if subtle.ConstantTimeCompare([]byte(refreshHash), []byte(session.RefreshHash)) != 1 {
+		log.Warn("refresh token reused, revoking session", slog.String("username", session.Username))
+		if err := a.sessionStore.RevokeSession(ctx, session.Id); err != nil {
+			log.Error("failed to revoke session", sl.Err(err))
+		}
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidToken)
+	}
+	newRefreshToken, err := newRefreshToken(session.Id)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	err = a.sessionStore.RotateSession(ctx, session.Id, refreshHash, hashToken(newRefreshToken), time.Now().Add(a.RefreshTokenTTL))
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return nil, fmt.Errorf("%s %w", op, ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	user, err := a.userProvider.GetUser(ctx, session.Username)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s %w", op, ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	accessToken, err := a.keys.NewToken(*user, session.Id, a.TokenTTL)
+	if err != nil {
+		log.Error("failed to generate token", sl.Err(err))
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresIn:    a.TokenTTL,
+	}, nil
+}
+
+// Logout revokes the session of the access token, which also invalidates
+// every access token issued for it.
+func (a *AuthService) Logout(ctx context.Context, tokenString string) error {
+	const op = "services.auth.Logout"
+	log := a.log.With(slog.String("op", op))
+	log.Info("logging out")
+	claims, err := a.keys.ParseToken(tokenString)
+	if err != nil {
+		return fmt.Errorf("%s %w", op, ErrInvalidToken)
+	}
+	if claims.SessionId != "" {
+		if err := a.sessionStore.RevokeSession(ctx, claims.SessionId); err != nil && !errors.Is(err, storage.ErrSessionNotFound) {
+			return fmt.Errorf("%s %w", op, err)
+		}
+	}
+	if claims.Id != "" {
+		if err := a.sessionStore.RevokeToken(ctx, claims.Id, claims.ExpiresAt); err != nil {
+			return fmt.Errorf("%s %w", op, err)
+		}
+	}
+	return nil
+}
+
+// dummyHash is compared against when the user doesn't exist.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func (a *AuthService) startSession(ctx context.Context, user models.User) (*models.TokenPair, error) {
+	sessionId, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := newRefreshToken(sessionId)
+	if err != nil {
+		return nil, err
+	}
+	err = a.sessionStore.SaveSession(ctx, models.Session{
+		Id:          sessionId,
+		Username:    user.Username,
+		RefreshHash: hashToken(refreshToken),
+		ExpiresAt:   time.Now().Add(a.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := a.keys.NewToken(user, sessionId, a.TokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    a.TokenTTL,
+	}, nil
+}
+
+// newRefreshToken returns "<session id>.<random secret>", the session id
+// prefix lets Refresh find the session without indexing the hash.
+func newRefreshToken(sessionId string) (string, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	return sessionId + "." + secret, nil
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Register creates an account after checking the username format and the
+// password policy, and starts a session for it.
+func (a *AuthService) Register(ctx context.Context, username string, password string) (*models.TokenPair, error) {
+	const op = "services.auth.Register"
 	log := a.log.With(slog.String("op", op))
 	log.Info("registering user")
+	if err := validateUsername(username); err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	if err := a.registration.validatePassword(username, password); err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	if _, err := a.createUser(ctx, username, password); err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	user, err := a.userProvider.GetUser(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	tokens, err := a.startSession(ctx, *user)
+	if err != nil {
+		log.Error("failed to start session", sl.Err(err))
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return tokens, nil
+}
+
+func (a *AuthService) createUser(ctx context.Context, username string, password string) (int, error) {
+	const op = "services.auth.RegisterNewUser"
+	log := a.log.With(slog.String("op", op))
+	log.Info("creating user")
+	if storage.IsSystemAccount(username) {
+		log.Warn("username is reserved", slog.String("username", username))
+		return 0, fmt.Errorf("%s %w", op, ErrInvalidUsername)
+	}
 	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Error("failed to generate password hash", err.Error())
+		log.Error("failed to generate password hash", sl.Err(err))
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	id, err := a.userSaver.SaveUser(ctx, username, passHash)
+	id, err := a.userSaver.SaveUser(ctx, username, passHash, a.welcomeGrant)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserExists) {
-			log.Warn("user is already exists", err.Error())
-			return 0, fmt.Errorf("%s %w", op, ErrInvalidCredentials)
+			log.Warn("user is already exists", sl.Err(err))
+			return 0, fmt.Errorf("%s %w", op, ErrUserExists)
 		}
-		log.Error("failed to save user", err.Error())
+		log.Error("failed to save user", sl.Err(err))
 		return 0, fmt.Errorf("%s %w", op, err)
 	}
 	return id, nil
 }
 
-func (a *AuthService) Authorize(tokenString string) (string, error) {
+// Authorize checks an access token and returns the principal of its user
+// with the role the user has now.
+func (a *AuthService) Authorize(ctx context.Context, tokenString string) (*models.Principal, error) {
 	const op = "services.auth.Authorize"
 	log := a.log.With(slog.String("op", op))
 	log.Info("authorize user")
-	username, err := jwt.ParseToken(tokenString, a.secret)
+	claims, err := a.keys.ParseToken(tokenString)
+	if err != nil {
+		log.Warn("failed to authorize user", sl.Err(err))
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidToken)
+	}
+	if claims.Id == "" || claims.UserId == 0 {
+		log.Warn("token has no id or user id")
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidToken)
+	}
+	revoked, err := a.sessionStore.IsTokenRevoked(ctx, claims.Id, claims.SessionId)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	if revoked {
+		log.Warn("token is revoked", slog.String("username", claims.Username))
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidToken)
+	}
+	// the role in the claims is the one at login, a demoted admin must lose
+	// the admin scopes right away
+	user, err := a.userProvider.GetUser(ctx, claims.Username)
 	if err != nil {
-		log.Error("failed to authorize user", err.Error())
-		return "", fmt.Errorf("%s: %w")
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s %w", op, ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	if user.Id != claims.UserId {
+		log.Warn("token user id does not match", slog.String("username", claims.Username))
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidToken)
 	}
-	return username, nil
+	return models.NewUserPrincipal(*user), nil
+}
+
+// JWKS returns the public keys access tokens can be verified with.
+func (a *AuthService) JWKS() jwt.JWKS {
+	return a.keys.JWKS()
 }
 
 func (a *AuthService) GetCoinsInfo(ctx context.Context, username string) (int, error) {
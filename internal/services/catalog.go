@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+type CatalogService struct {
+	catalogProvider CatalogProvider
+	catalogSaver    CatalogSaver
+	log             *slog.Logger
+}
+
+type CatalogSaver interface {
+	SaveMerchItem(ctx context.Context, item models.MerchItem, actor string) (int, error)
+	UpdateMerchItem(ctx context.Context, item models.MerchItem, setStock bool, actor string) error
+	SetMerchItemAvailable(ctx context.Context, name string, available bool) error
+	GetMerchItemPrices(ctx context.Context, name string) ([]models.MerchItemPrice, error)
+}
+
+func NewCatalogService(catalogProvider CatalogProvider, catalogSaver CatalogSaver, log *slog.Logger) *CatalogService {
+	return &CatalogService{
+		catalogProvider: catalogProvider,
+		catalogSaver:    catalogSaver,
+		log:             log,
+	}
+}
+
+var (
+	ErrItemExists      = errors.New("item already exists")
+	ErrInvalidItemName = errors.New("item name must be 1-64 characters of a-z, 0-9, '-' or '_'")
+	ErrInvalidPrice    = errors.New("price must be positive")
+	ErrInvalidStock    = errors.New("stock can't be negative")
+	ErrInvalidLimit    = errors.New("per-user limit must be positive")
+)
+
+const maxItemNameLength = 64
+
+func (c *CatalogService) GetItems(ctx context.Context) ([]models.MerchItem, error) {
+	const op = "services.catalog.GetItems"
+	log := c.log.With(slog.String("op", op))
+	log.Info("getting catalog items")
+	items, err := c.catalogProvider.ListMerchItems(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return items, nil
+}
+
+func (c *CatalogService) GetItem(ctx context.Context, name string) (*models.MerchItem, error) {
+	const op = "services.catalog.GetItem"
+	log := c.log.With(slog.String("op", op))
+	log.Info("getting catalog item")
+	item, err := c.catalogProvider.GetMerchItem(ctx, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrItemNotFound) {
+			log.Warn("item not found", slog.String("item", name))
+			return nil, fmt.Errorf("%s %w", op, ErrItemNotFound)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return item, nil
+}
+
+// ItemUpdate holds the fields to change on a catalog item, nil fields are
+// left as is. Stock and PerUserLimit are only changed when their Set flag
+// is true, a nil value then removes the limit.
+type ItemUpdate struct {
+	Price           *int
+	Description     *string
+	SetStock        bool
+	Stock           *int
+	SetPerUserLimit bool
+	PerUserLimit    *int
+}
+
+// CreateItem adds a new available item to the catalog on behalf of the admin actor.
+func (c *CatalogService) CreateItem(ctx context.Context, actor string, item models.MerchItem) (*models.MerchItem, error) {
+	const op = "services.catalog.CreateItem"
+	log := c.log.With(slog.String("op", op))
+	log.Info("creating catalog item", slog.String("actor", actor), slog.String("item", item.Name))
+	if !validItemName(item.Name) {
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidItemName)
+	}
+	if item.Price <= 0 {
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidPrice)
+	}
+	if err := validateLimits(item.Stock, item.PerUserLimit); err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	id, err := c.catalogSaver.SaveMerchItem(ctx, item, actor)
+	if err != nil {
+		if errors.Is(err, storage.ErrItemExists) {
+			log.Warn("item already exists", slog.String("item", item.Name))
+			return nil, fmt.Errorf("%s %w", op, ErrItemExists)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	item.Id = id
+	item.Available = true
+	return &item, nil
+}
+
+// UpdateItem changes the price or description of an item. A new price only
+// applies to purchases made after the change.
+func (c *CatalogService) UpdateItem(ctx context.Context, actor, name string, update ItemUpdate) (*models.MerchItem, error) {
+	const op = "services.catalog.UpdateItem"
+	log := c.log.With(slog.String("op", op))
+	log.Info("updating catalog item", slog.String("actor", actor), slog.String("item", name))
+	if update.Price != nil && *update.Price <= 0 {
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidPrice)
+	}
+	if err := validateLimits(update.Stock, update.PerUserLimit); err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	item, err := c.GetItem(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	if update.Price != nil {
+		item.Price = *update.Price
+	}
+	if update.Description != nil {
+		item.Description = *update.Description
+	}
+	if update.SetPerUserLimit {
+		item.PerUserLimit = update.PerUserLimit
+	}
+	// Stock is only written when it is set so an update that doesn't touch
+	// it can't overwrite a decrement made by a concurrent purchase.
+	if update.SetStock {
+		item.Stock = update.Stock
+	}
+	if err := c.catalogSaver.UpdateMerchItem(ctx, *item, update.SetStock, actor); err != nil {
+		if errors.Is(err, storage.ErrItemNotFound) {
+			return nil, fmt.Errorf("%s %w", op, ErrItemNotFound)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return item, nil
+}
+
+// RetireItem hides an item from purchase, it stays in the catalog and in inventories.
+func (c *CatalogService) RetireItem(ctx context.Context, actor, name string) error {
+	const op = "services.catalog.RetireItem"
+	if err := c.setAvailable(ctx, op, actor, name, false); err != nil {
+		return fmt.Errorf("%s %w", op, err)
+	}
+	return nil
+}
+
+// RestoreItem makes a retired item available for purchase again.
+func (c *CatalogService) RestoreItem(ctx context.Context, actor, name string) error {
+	const op = "services.catalog.RestoreItem"
+	if err := c.setAvailable(ctx, op, actor, name, true); err != nil {
+		return fmt.Errorf("%s %w", op, err)
+	}
+	return nil
+}
+
+func (c *CatalogService) setAvailable(ctx context.Context, op, actor, name string, available bool) error {
+	log := c.log.With(slog.String("op", op))
+	log.Info("changing item availability", slog.String("actor", actor), slog.String("item", name), slog.Bool("available", available))
+	if err := c.catalogSaver.SetMerchItemAvailable(ctx, name, available); err != nil {
+		if errors.Is(err, storage.ErrItemNotFound) {
+			log.Warn("item not found", slog.String("item", name))
+			return ErrItemNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// GetItemPrices returns the price history of an item, newest first.
+func (c *CatalogService) GetItemPrices(ctx context.Context, name string) ([]models.MerchItemPrice, error) {
+	const op = "services.catalog.GetItemPrices"
+	log := c.log.With(slog.String("op", op))
+	log.Info("getting item prices")
+	prices, err := c.catalogSaver.GetMerchItemPrices(ctx, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrItemNotFound) {
+			return nil, fmt.Errorf("%s %w", op, ErrItemNotFound)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return prices, nil
+}
+
+func validateLimits(stock, perUserLimit *int) error {
+	if stock != nil && *stock < 0 {
+		return ErrInvalidStock
+	}
+	if perUserLimit != nil && *perUserLimit <= 0 {
+		return ErrInvalidLimit
+	}
+	return nil
+}
+
+func validItemName(name string) bool {
+	if name == "" || len(name) > maxItemNameLength {
+		return false
+	}
+	return strings.IndexFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+	}) < 0
+}
@@ -0,0 +1,22 @@
+package services
+
+import "fmt"
+
+// DetailError is one of the service errors with a detail that is safe to
+// show to clients, like which password rule failed.
+type DetailError struct {
+	Err    error
+	Detail string
+}
+
+func (e *DetailError) Error() string {
+	return e.Err.Error() + ": " + e.Detail
+}
+
+func (e *DetailError) Unwrap() error {
+	return e.Err
+}
+
+func withDetail(err error, format string, args ...interface{}) error {
+	return &DetailError{Err: err, Detail: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+type IdempotencyService struct {
+	keyStore IdempotencyKeyStore
+	log      *slog.Logger
+}
+
+type IdempotencyKeyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error
+	GetIdempotencyKey(ctx context.Context, username, key string) (*models.IdempotencyKey, error)
+	SaveIdempotencyResponse(ctx context.Context, key models.IdempotencyKey) error
+	DeleteIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error
+	ReclaimIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error
+}
+
+func NewIdempotencyService(keyStore IdempotencyKeyStore, log *slog.Logger) *IdempotencyService {
+	return &IdempotencyService{
+		keyStore: keyStore,
+		log:      log,
+	}
+}
+
+var (
+	ErrKeyReused     = errors.New("idempotency key was already used with a different request")
+	ErrKeyInProgress = errors.New("request with this idempotency key is still in progress")
+	ErrKeyProcessed  = errors.New("request with this idempotency key was already processed, its response is lost")
+)
+
+// idempotencyKeyTimeout is how long a reservation without a response blocks
+// retries. A request still running after it can no longer post with the key,
+// a server that crashed before finishing leaves the key to the next retry.
+const idempotencyKeyTimeout = time.Minute
+
+// Begin reserves key for the request identified by fingerprint. It returns
+// the reservation to process the request with and to pass to Complete or
+// Release, or the stored key with a StatusCode when the request was already
+// completed and its response should be replayed.
+func (i *IdempotencyService) Begin(ctx context.Context, username, key, fingerprint string) (*models.IdempotencyKey, error) {
+	const op = "services.idempotency.Begin"
+	log := i.log.With(slog.String("op", op))
+	log.Info("reserving idempotency key")
+	reservation := models.IdempotencyKey{
+		Username:    username,
+		Key:         key,
+		Fingerprint: fingerprint,
+		Attempt:     1,
+	}
+	err := i.keyStore.ReserveIdempotencyKey(ctx, reservation)
+	if err == nil {
+		return &reservation, nil
+	}
+	if !errors.Is(err, storage.ErrKeyExists) {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	stored, err := i.keyStore.GetIdempotencyKey(ctx, username, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	if stored.Fingerprint != fingerprint {
+		log.Warn("idempotency key reused", slog.String("key", key))
+		return nil, fmt.Errorf("%s %w", op, ErrKeyReused)
+	}
+	if stored.StatusCode != 0 {
+		return stored, nil
+	}
+	if time.Since(stored.CreatedAt) < idempotencyKeyTimeout {
+		return nil, fmt.Errorf("%s %w", op, ErrKeyInProgress)
+	}
+	if stored.TransactionId != 0 {
+		// the server stopped between posting and storing the response
+		log.Warn("idempotency key response lost", slog.String("key", key), slog.Int("transaction", stored.TransactionId))
+		return nil, fmt.Errorf("%s %w", op, withDetail(ErrKeyProcessed, "transaction %d", stored.TransactionId))
+	}
+	log.Warn("reclaiming stale idempotency key", slog.String("key", key))
+	if err := i.keyStore.ReclaimIdempotencyKey(ctx, *stored); err != nil {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%s %w", op, ErrKeyInProgress)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	stored.Attempt++
+	return stored, nil
+}
+
+// Complete stores the response of the request processed with reservation.
+func (i *IdempotencyService) Complete(ctx context.Context, reservation *models.IdempotencyKey, statusCode int, response []byte) error {
+	const op = "services.idempotency.Complete"
+	key := *reservation
+	key.StatusCode = statusCode
+	key.Response = response
+	if err := i.keyStore.SaveIdempotencyResponse(ctx, key); err != nil {
+		return fmt.Errorf("%s %w", op, err)
+	}
+	return nil
+}
+
+// Release forgets reservation so the request can be retried after a server
+// error. A key a transaction was posted with is kept, the storage marks it in
+// the same database transaction.
+func (i *IdempotencyService) Release(ctx context.Context, reservation *models.IdempotencyKey) error {
+	const op = "services.idempotency.Release"
+	if err := i.keyStore.DeleteIdempotencyKey(ctx, *reservation); err != nil {
+		return fmt.Errorf("%s %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage/memory"
+)
+
+// agedKeys makes every stored idempotency key look age older.
+type agedKeys struct {
+	*memory.Storage
+	age time.Duration
+}
+
+func (a *agedKeys) GetIdempotencyKey(ctx context.Context, username, key string) (*models.IdempotencyKey, error) {
+	stored, err := a.Storage.GetIdempotencyKey(ctx, username, key)
+	if err != nil {
+		return nil, err
+	}
+	stored.CreatedAt = stored.CreatedAt.Add(-a.age)
+	return stored, nil
+}
+
+func newIdempotencyTest(t *testing.T) (*memory.Storage, *agedKeys, *IdempotencyService, *TransactionService) {
+	t.Helper()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.New()
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := store.SaveUser(context.Background(), username, []byte("hash"), 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := &agedKeys{Storage: store}
+	return store, keys, NewIdempotencyService(keys, log), NewTransactionsService(store, store, store, log)
+}
+
+func TestStaleReservationIsReclaimed(t *testing.T) {
+	ctx := context.Background()
+	_, keys, idempotency, transactions := newIdempotencyTest(t)
+
+	stale, err := idempotency.Begin(ctx, "alice", "k", "fp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idempotency.Begin(ctx, "alice", "k", "fp"); !errors.Is(err, ErrKeyInProgress) {
+		t.Fatalf("Begin of a fresh reservation = %v, want ErrKeyInProgress", err)
+	}
+	keys.age = 2 * idempotencyKeyTimeout
+	retry, err := idempotency.Begin(ctx, "alice", "k", "fp")
+	if err != nil {
+		t.Fatalf("Begin of a stale reservation: %v", err)
+	}
+	if retry.Attempt != stale.Attempt+1 {
+		t.Fatalf("attempt = %d, want %d", retry.Attempt, stale.Attempt+1)
+	}
+
+	// the request that lost the key can no longer post with it
+	if _, err := transactions.SaveTransaction(ctx, "alice", "bob", "", 10, stale); !errors.Is(err, ErrKeyInProgress) {
+		t.Fatalf("SaveTransaction with a reclaimed key = %v, want ErrKeyInProgress", err)
+	}
+	if _, err := transactions.SaveTransaction(ctx, "alice", "bob", "", 10, retry); err != nil {
+		t.Fatalf("SaveTransaction with the new reservation: %v", err)
+	}
+}
+
+func TestCommittedKeyIsNeitherReleasedNorReclaimed(t *testing.T) {
+	ctx := context.Background()
+	store, keys, idempotency, transactions := newIdempotencyTest(t)
+
+	reservation, err := idempotency.Begin(ctx, "alice", "k", "fp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := transactions.SaveTransaction(ctx, "alice", "bob", "", 10, reservation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the handler failed with a server error after the transfer committed
+	if err := idempotency.Release(ctx, reservation); err == nil {
+		t.Fatal("Release deleted a key a transaction was posted with")
+	}
+	keys.age = 2 * idempotencyKeyTimeout
+	if _, err := idempotency.Begin(ctx, "alice", "k", "fp"); !errors.Is(err, ErrKeyProcessed) {
+		t.Fatalf("Begin after a lost response = %v, want ErrKeyProcessed", err)
+	}
+	stored, err := store.GetIdempotencyKey(ctx, "alice", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.TransactionId != id {
+		t.Errorf("key transaction = %d, want %d", stored.TransactionId, id)
+	}
+	alice, err := store.GetUser(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Coins != 90 {
+		t.Errorf("alice has %d coins, want 90", alice.Coins)
+	}
+}
+
+func TestUncommittedKeyIsReleased(t *testing.T) {
+	ctx := context.Background()
+	_, _, idempotency, _ := newIdempotencyTest(t)
+
+	reservation, err := idempotency.Begin(ctx, "alice", "k", "fp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idempotency.Release(ctx, reservation); err != nil {
+		t.Fatal(err)
+	}
+	retry, err := idempotency.Begin(ctx, "alice", "k", "fp")
+	if err != nil {
+		t.Fatalf("Begin after release: %v", err)
+	}
+	if retry.StatusCode != 0 {
+		t.Errorf("released key was replayed with status %d", retry.StatusCode)
+	}
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/lib/logger/sl"
+	"github.com/splashk1e/avito-shop/internal/models"
+)
+
+// LoginGuard throttles password guessing. Failed logins are counted per
+// username and per client IP, once a counter passes its free attempts every
+// further failure doubles the time the next login has to wait.
+type LoginGuard struct {
+	store  LoginAttemptStore
+	policy LoginThrottlePolicy
+	log    *slog.Logger
+}
+
+type LoginAttemptStore interface {
+	TakeLoginAttempt(ctx context.Context, key string, window time.Duration, lockedFor func(models.LoginAttempts) time.Duration) (*models.LoginAttempt, time.Duration, error)
+	RefundLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
+
+type LoginThrottlePolicy struct {
+	// UsernameAttempts and IPAttempts are the failures allowed before the
+	// backoff starts.
+	UsernameAttempts int
+	IPAttempts       int
+	// BaseDelay is the first lockout, MaxDelay caps the doubling.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long a failure is remembered.
+	Window time.Duration
+}
+
+func NewLoginGuard(store LoginAttemptStore, policy LoginThrottlePolicy, log *slog.Logger) *LoginGuard {
+	return &LoginGuard{
+		store:  store,
+		policy: policy,
+		log:    log,
+	}
+}
+
+var ErrTooManyAttempts = errors.New("too many failed login attempts")
+
+// LockoutError is returned while logins are locked, it matches ErrTooManyAttempts.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockoutError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// Begin counts a login of username from ip as failed before the password is
+// checked, so parallel requests can't get past the limits. It returns a
+// LockoutError if username or ip has to wait before the next login. Pass the
+// returned attempts to Succeed, or to Refund when the login failed for
+// another reason than wrong credentials.
+func (g *LoginGuard) Begin(ctx context.Context, username, ip string) ([]models.LoginAttempt, error) {
+	const op = "services.login_guard.Begin"
+	taken := make([]models.LoginAttempt, 0, 2)
+	for _, counter := range g.counters(username, ip) {
+		free := counter.free
+		attempt, retryAfter, err := g.store.TakeLoginAttempt(ctx, counter.key, g.policy.Window, func(attempts models.LoginAttempts) time.Duration {
+			return g.lockedFor(&attempts, free)
+		})
+		if err != nil {
+			g.Refund(ctx, taken)
+			return nil, fmt.Errorf("%s %w", op, err)
+		}
+		if retryAfter > 0 {
+			g.Refund(ctx, taken)
+			g.log.With(slog.String("op", op)).Warn("login locked",
+				slog.String("username", username), slog.String("ip", ip), slog.Duration("retry_after", retryAfter))
+			return nil, fmt.Errorf("%s %w", op, &LockoutError{RetryAfter: retryAfter})
+		}
+		taken = append(taken, *attempt)
+	}
+	return taken, nil
+}
+
+// Refund takes back attempts of a login that wasn't a wrong guess.
+func (g *LoginGuard) Refund(ctx context.Context, attempts []models.LoginAttempt) {
+	const op = "services.login_guard.Refund"
+	for _, attempt := range attempts {
+		if err := g.store.RefundLoginAttempt(ctx, attempt); err != nil {
+			g.log.With(slog.String("op", op)).Error("failed to refund login attempt", sl.Err(err))
+		}
+	}
+}
+
+// Succeed refunds the attempts of a successful login and clears the failures
+// of username. The IP counter keeps its earlier failures so logging into one
+// account doesn't reset guessing against others.
+func (g *LoginGuard) Succeed(ctx context.Context, username string, attempts []models.LoginAttempt) {
+	const op = "services.login_guard.Succeed"
+	g.Refund(ctx, attempts)
+	if err := g.store.ResetLoginAttempts(ctx, usernameCounter(username)); err != nil {
+		g.log.With(slog.String("op", op)).Error("failed to reset login failures", sl.Err(err))
+	}
+}
+
+type attemptCounter struct {
+	key  string
+	free int
+}
+
+func (g *LoginGuard) counters(username, ip string) []attemptCounter {
+	return []attemptCounter{
+		{key: usernameCounter(username), free: g.policy.UsernameAttempts},
+		{key: "ip:" + ip, free: g.policy.IPAttempts},
+	}
+}
+
+func usernameCounter(username string) string {
+	return "user:" + username
+}
+
+func (g *LoginGuard) lockedFor(attempts *models.LoginAttempts, free int) time.Duration {
+	if attempts.Failures < free || time.Since(attempts.LastFailure) > g.policy.Window {
+		return 0
+	}
+	delay := g.policy.BaseDelay
+	for i := free; i < attempts.Failures && delay < g.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.policy.MaxDelay {
+		delay = g.policy.MaxDelay
+	}
+	return time.Until(attempts.LastFailure.Add(delay))
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage/memory"
+)
+
+var testThrottle = LoginThrottlePolicy{
+	UsernameAttempts: 3,
+	IPAttempts:       10,
+	BaseDelay:        time.Minute,
+	MaxDelay:         5 * time.Minute,
+	Window:           time.Hour,
+}
+
+func newTestGuard() *LoginGuard {
+	return NewLoginGuard(memory.NewAttemptStore(), testThrottle, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestLockoutDoublesUpToMaxDelay(t *testing.T) {
+	guard := newTestGuard()
+	now := time.Now()
+	for _, tt := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Minute},
+		{failures: 4, want: 2 * time.Minute},
+		{failures: 5, want: 4 * time.Minute},
+		{failures: 6, want: 5 * time.Minute},
+		{failures: 20, want: 5 * time.Minute},
+	} {
+		got := guard.lockedFor(&models.LoginAttempts{Failures: tt.failures, LastFailure: now}, testThrottle.UsernameAttempts)
+		if got > tt.want || got < tt.want-time.Second {
+			t.Errorf("%d failures lock for %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+	old := &models.LoginAttempts{Failures: 20, LastFailure: now.Add(-testThrottle.Window - time.Second)}
+	if got := guard.lockedFor(old, testThrottle.UsernameAttempts); got != 0 {
+		t.Errorf("failures outside the window lock for %s", got)
+	}
+}
+
+func TestLoginGuardLocksAfterFreeAttempts(t *testing.T) {
+	ctx := context.Background()
+	guard := newTestGuard()
+	for i := 0; i < testThrottle.UsernameAttempts; i++ {
+		if _, err := guard.Begin(ctx, "alice", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+	_, err := guard.Begin(ctx, "alice", "10.0.0.2")
+	var lockout *LockoutError
+	if !errors.As(err, &lockout) {
+		t.Fatalf("Begin after %d failures = %v, want a lockout", testThrottle.UsernameAttempts, err)
+	}
+	if lockout.RetryAfter <= 0 || lockout.RetryAfter > testThrottle.BaseDelay {
+		t.Errorf("retry after %s, want up to %s", lockout.RetryAfter, testThrottle.BaseDelay)
+	}
+	// other users from the same address are not locked
+	if _, err := guard.Begin(ctx, "bob", "10.0.0.1"); err != nil {
+		t.Errorf("Begin for another user: %v", err)
+	}
+}
+
+func TestRefundedAttemptsDontCount(t *testing.T) {
+	ctx := context.Background()
+	guard := newTestGuard()
+	for i := 0; i < 2*testThrottle.IPAttempts; i++ {
+		attempts, err := guard.Begin(ctx, "alice", "10.0.0.1")
+		if err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+		if i%2 == 0 {
+			guard.Refund(ctx, attempts)
+		} else {
+			guard.Succeed(ctx, "alice", attempts)
+		}
+	}
+}
+
+func TestParallelAttemptsCantExceedTheLimit(t *testing.T) {
+	ctx := context.Background()
+	guard := newTestGuard()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := guard.Begin(ctx, "alice", "10.0.0.1"); err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != testThrottle.UsernameAttempts {
+		t.Errorf("%d parallel attempts got through, want %d", allowed, testThrottle.UsernameAttempts)
+	}
+}
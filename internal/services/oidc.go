@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/splashk1e/avito-shop/internal/lib/logger/sl"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+	"golang.org/x/oauth2"
+)
+
+// OIDCService logs users in with the authorization code flow of an OpenID
+// Connect provider and issues the same tokens as a password login.
+type OIDCService struct {
+	log           *slog.Logger
+	auth          *AuthService
+	identities    IdentityStore
+	oauth         oauth2.Config
+	verifier      *oidc.IDTokenVerifier
+	usernameClaim string
+}
+
+type IdentityStore interface {
+	SaveUserIdentity(ctx context.Context, identity models.UserIdentity) error
+	GetUserIdentity(ctx context.Context, issuer, subject string) (*models.UserIdentity, error)
+}
+
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// UsernameClaim is the claim the username of a new shop user is made
+	// from, the local part of the email is used when it is missing.
+	UsernameClaim string
+	// Scopes are requested in addition to "openid".
+	Scopes []string
+}
+
+// OIDCLogin is one started login. State, Nonce and Verifier must be kept by
+// the client, they are checked when the provider redirects back.
+type OIDCLogin struct {
+	URL      string
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+var ErrInvalidOIDCLogin = errors.New("invalid single sign-on response")
+
+// provisionAttempts is how many usernames are tried for a new user before
+// giving up.
+const provisionAttempts = 5
+
+// NewOIDCService fetches the discovery document of cfg.Issuer.
+func NewOIDCService(ctx context.Context, log *slog.Logger, auth *AuthService, identities IdentityStore, cfg OIDCConfig) (*OIDCService, error) {
+	const op = "services.oidc.NewOIDCService"
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return &OIDCService{
+		log:        log,
+		auth:       auth,
+		identities: identities,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, cfg.Scopes...),
+		},
+		verifier:      provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		usernameClaim: cfg.UsernameClaim,
+	}, nil
+}
+
+// StartLogin returns the provider URL to send the user to.
+func (s *OIDCService) StartLogin() (*OIDCLogin, error) {
+	const op = "services.oidc.StartLogin"
+	state, err := randomString(16)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	verifier := oauth2.GenerateVerifier()
+	return &OIDCLogin{
+		URL:      s.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)),
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+	}, nil
+}
+
+// FinishLogin exchanges the authorization code, verifies the id token and
+// starts a session for the shop user linked to its subject. Users logging
+// in for the first time get a new account, even when registration is
+// explicit, since the provider already vouches for them.
+func (s *OIDCService) FinishLogin(ctx context.Context, code, verifier, nonce string) (*models.TokenPair, error) {
+	const op = "services.oidc.FinishLogin"
+	log := s.log.With(slog.String("op", op))
+	log.Info("finishing single sign-on")
+	token, err := s.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			log.Warn("code exchange rejected", sl.Err(err))
+			return nil, fmt.Errorf("%s %w", op, ErrInvalidOIDCLogin)
+		}
+		log.Error("failed to exchange code", sl.Err(err))
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		log.Warn("token response has no id token")
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidOIDCLogin)
+	}
+	idToken, err := s.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Warn("invalid id token", sl.Err(err))
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidOIDCLogin)
+	}
+	if idToken.Nonce != nonce {
+		log.Warn("id token nonce mismatch")
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidOIDCLogin)
+	}
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	identity := models.ExternalIdentity{
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+	}
+	identity.PreferredUsername, _ = claims[s.usernameClaim].(string)
+	identity.Email, _ = claims["email"].(string)
+	return s.loginWithIdentity(ctx, identity)
+}
+
+func (s *OIDCService) loginWithIdentity(ctx context.Context, identity models.ExternalIdentity) (*models.TokenPair, error) {
+	const op = "services.oidc.loginWithIdentity"
+	log := s.log.With(slog.String("op", op))
+	linked, err := s.identities.GetUserIdentity(ctx, identity.Issuer, identity.Subject)
+	if errors.Is(err, storage.ErrIdentityNotFound) {
+		linked, err = s.provisionUser(ctx, identity)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	user, err := s.auth.userProvider.GetUser(ctx, linked.Username)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	tokens, err := s.auth.startSession(ctx, *user)
+	if err != nil {
+		log.Error("failed to start session", sl.Err(err))
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return tokens, nil
+}
+
+// provisionUser creates a shop user for a new identity. Existing accounts
+// with the same name are never linked, that would let whoever controls the
+// provider claim take over a password account, a suffix is added instead.
+func (s *OIDCService) provisionUser(ctx context.Context, identity models.ExternalIdentity) (*models.UserIdentity, error) {
+	const op = "services.oidc.provisionUser"
+	log := s.log.With(slog.String("op", op))
+	password, err := randomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	base := oidcUsername(identity)
+	username := base
+	for attempt := 1; ; attempt++ {
+		_, err = s.auth.createUser(ctx, username, password)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrUserExists) && !errors.Is(err, ErrInvalidUsername) {
+			return nil, fmt.Errorf("%s %w", op, err)
+		}
+		if attempt == provisionAttempts {
+			log.Error("no free username", slog.String("username", base))
+			return nil, fmt.Errorf("%s %w", op, err)
+		}
+		suffix, err := randomString(3)
+		if err != nil {
+			return nil, fmt.Errorf("%s %w", op, err)
+		}
+		username = base[:min(len(base), maxUsernameLength-len(suffix)-1)] + "-" + suffix
+	}
+	linked := models.UserIdentity{
+		Issuer:   identity.Issuer,
+		Subject:  identity.Subject,
+		Username: username,
+	}
+	if err := s.identities.SaveUserIdentity(ctx, linked); err != nil {
+		if !errors.Is(err, storage.ErrIdentityExists) {
+			return nil, fmt.Errorf("%s %w", op, err)
+		}
+		// A concurrent first login linked the identity first, the user
+		// created here stays unused.
+		log.Warn("identity linked concurrently", slog.String("username", username))
+		existing, err := s.identities.GetUserIdentity(ctx, identity.Issuer, identity.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("%s %w", op, err)
+		}
+		return existing, nil
+	}
+	log.Info("provisioned user", slog.String("username", username), slog.String("issuer", identity.Issuer))
+	return &linked, nil
+}
+
+// oidcUsername turns the claims of identity into a valid username.
+func oidcUsername(identity models.ExternalIdentity) string {
+	name := identity.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '-'
+	}, name)
+	name = strings.TrimLeft(name, "._-")
+	if len(name) > maxUsernameLength {
+		name = name[:maxUsernameLength]
+	}
+	if len(name) < minUsernameLength {
+		name = "sso-" + hashToken(identity.Issuer + " " + identity.Subject)[:8]
+	}
+	return name
+}
+
+// SecureCookies reports whether the callback is served over https, so the
+// login cookie can be marked secure.
+func (s *OIDCService) SecureCookies() bool {
+	return strings.HasPrefix(s.oauth.RedirectURL, "https://")
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/lib/logger/sl"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordResetStore interface {
+	SavePasswordReset(ctx context.Context, reset models.PasswordReset) error
+	GetPasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error)
+	UsePasswordReset(ctx context.Context, tokenHash string) error
+}
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// ChangePassword sets a new password after checking the old one. All
+// sessions of the user are revoked and a new one is started for the caller.
+func (a *AuthService) ChangePassword(ctx context.Context, username, oldPassword, newPassword string) (*models.TokenPair, error) {
+	const op = "services.auth.ChangePassword"
+	log := a.log.With(slog.String("op", op))
+	log.Info("changing password")
+	user, err := a.userProvider.GetUser(ctx, username)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s %w", op, ErrInvalidCredentials)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PassHash), []byte(oldPassword)); err != nil {
+		log.Info("invalid password", sl.Err(err))
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidCredentials)
+	}
+	if err := a.setPassword(ctx, username, newPassword); err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	tokens, err := a.startSession(ctx, *user)
+	if err != nil {
+		log.Error("failed to start session", sl.Err(err))
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return tokens, nil
+}
+
+// IssuePasswordReset creates a one-time token that lets username set a new
+// password without the old one. Only the admin actor sees the token.
+func (a *AuthService) IssuePasswordReset(ctx context.Context, actor, username string) (string, time.Time, error) {
+	const op = "services.auth.IssuePasswordReset"
+	log := a.log.With(slog.String("op", op))
+	log.Info("issuing password reset", slog.String("actor", actor), slog.String("username", username))
+	if storage.IsSystemAccount(username) {
+		return "", time.Time{}, fmt.Errorf("%s %w", op, ErrUserNotFound)
+	}
+	user, err := a.userProvider.GetUser(ctx, username)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", time.Time{}, fmt.Errorf("%s %w", op, ErrUserNotFound)
+		}
+		return "", time.Time{}, fmt.Errorf("%s %w", op, err)
+	}
+	// Service accounts authenticate with API keys only.
+	if user.Role == models.RoleService {
+		return "", time.Time{}, fmt.Errorf("%s %w", op, ErrUserNotFound)
+	}
+	token, err := randomString(32)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s %w", op, err)
+	}
+	expiresAt := time.Now().Add(a.PasswordResetTTL)
+	err = a.passwordResets.SavePasswordReset(ctx, models.PasswordReset{
+		TokenHash: hashToken(token),
+		Username:  username,
+		CreatedBy: actor,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s %w", op, err)
+	}
+	return token, expiresAt, nil
+}
+
+// ResetPassword redeems a reset token and sets newPassword. All sessions of
+// the user are revoked.
+func (a *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	const op = "services.auth.ResetPassword"
+	log := a.log.With(slog.String("op", op))
+	log.Info("resetting password")
+	tokenHash := hashToken(token)
+	reset, err := a.passwordResets.GetPasswordReset(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrResetNotFound) {
+			return fmt.Errorf("%s %w", op, ErrInvalidResetToken)
+		}
+		return fmt.Errorf("%s %w", op, err)
+	}
+	if reset.Used || !reset.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%s %w", op, ErrInvalidResetToken)
+	}
+	// Check the policy before redeeming so a weak password doesn't burn the token.
+	if err := a.registration.validatePassword(reset.Username, newPassword); err != nil {
+		return fmt.Errorf("%s %w", op, err)
+	}
+	if err := a.passwordResets.UsePasswordReset(ctx, tokenHash); err != nil {
+		if errors.Is(err, storage.ErrResetNotFound) {
+			return fmt.Errorf("%s %w", op, ErrInvalidResetToken)
+		}
+		return fmt.Errorf("%s %w", op, err)
+	}
+	if err := a.setPassword(ctx, reset.Username, newPassword); err != nil {
+		return fmt.Errorf("%s %w", op, err)
+	}
+	return nil
+}
+
+// setPassword checks the password policy, stores the new hash and revokes
+// every session of username.
+func (a *AuthService) setPassword(ctx context.Context, username, password string) error {
+	if err := a.registration.validatePassword(username, password); err != nil {
+		return err
+	}
+	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := a.userSaver.SetUserPassword(ctx, username, passHash); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return a.sessionStore.RevokeUserSessions(ctx, username)
+}
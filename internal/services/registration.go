@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// RegistrationPolicy controls how accounts are created.
+type RegistrationPolicy struct {
+	// AutoRegister creates unknown users on login as the Avito spec
+	// requires. Without it accounts are only created by Register.
+	AutoRegister bool
+	// MinPasswordLength is the shortest password Register accepts.
+	MinPasswordLength int
+}
+
+var (
+	ErrUserExists      = errors.New("user already exists")
+	ErrInvalidUsername = errors.New("username must be 3-32 characters of letters, digits, '.', '_' or '-' and start with a letter or digit")
+	ErrWeakPassword    = errors.New("password is too weak")
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 32
+	// maxPasswordLength is the most bcrypt can hash.
+	maxPasswordLength = 72
+)
+
+// commonPasswords are rejected regardless of their length.
+var commonPasswords = map[string]struct{}{
+	"password":    {},
+	"password1":   {},
+	"password123": {},
+	"12345678":    {},
+	"123456789":   {},
+	"1234567890":  {},
+	"11111111":    {},
+	"00000000":    {},
+	"87654321":    {},
+	"qwerty123":   {},
+	"qwertyuiop":  {},
+	"iloveyou":    {},
+	"sunshine":    {},
+	"princess":    {},
+	"football":    {},
+	"baseball":    {},
+	"welcome1":    {},
+	"admin123":    {},
+	"letmein1":    {},
+	"abc12345":    {},
+	"avito123":    {},
+	"avitoshop":   {},
+}
+
+func validateUsername(username string) error {
+	if len(username) < minUsernameLength || len(username) > maxUsernameLength {
+		return ErrInvalidUsername
+	}
+	for i, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case i > 0 && (r == '.' || r == '_' || r == '-'):
+		default:
+			return ErrInvalidUsername
+		}
+	}
+	return nil
+}
+
+func (p RegistrationPolicy) validatePassword(username, password string) error {
+	if utf8.RuneCountInString(password) < p.MinPasswordLength {
+		return withDetail(ErrWeakPassword, "it must be at least %d characters long", p.MinPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return withDetail(ErrWeakPassword, "it must be at most %d bytes long", maxPasswordLength)
+	}
+	if _, ok := commonPasswords[strings.ToLower(password)]; ok {
+		return withDetail(ErrWeakPassword, "it is too common")
+	}
+	if strings.EqualFold(password, username) {
+		return withDetail(ErrWeakPassword, "it must differ from the username")
+	}
+	return nil
+}
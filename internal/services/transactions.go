@@ -2,10 +2,15 @@ package services
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/splashk1e/avito-shop/internal/lib/logger/sl"
 	"github.com/splashk1e/avito-shop/internal/models"
 	"github.com/splashk1e/avito-shop/internal/storage"
 )
@@ -13,91 +18,314 @@ import (
 type TransactionService struct {
 	transactionSaver    TransactionSaver
 	transactionProvider TransactionProvider
+	catalogProvider     CatalogProvider
 	log                 *slog.Logger
 }
 
 type TransactionProvider interface {
-	GetTransactions(ctx context.Context, username string) ([]models.Transaction, error)
-	GetItems(ctx context.Context, username string) ([]string, error)
+	ListTransactions(ctx context.Context, filter models.TransactionFilter) ([]models.Transaction, error)
+	GetInventory(ctx context.Context, username string) ([]models.InventoryItem, error)
+	GetCoinHistory(ctx context.Context, username string) (*models.CoinHistory, error)
 }
 
 type TransactionSaver interface {
-	SaveTransaction(ctx context.Context, transaction models.Transaction) (int, error)
+	// SaveTransaction returns the id of the saved transaction and the balance
+	// it left the sender with.
+	SaveTransaction(ctx context.Context, transaction models.Transaction) (int, int, error)
 }
 
-func NewTransactionsService(transactionSaver TransactionSaver, transactionProvider TransactionProvider, log *slog.Logger) *TransactionService {
+type CatalogProvider interface {
+	GetMerchItem(ctx context.Context, name string) (*models.MerchItem, error)
+	ListMerchItems(ctx context.Context) ([]models.MerchItem, error)
+}
+
+func NewTransactionsService(transactionSaver TransactionSaver, transactionProvider TransactionProvider, catalogProvider CatalogProvider, log *slog.Logger) *TransactionService {
 	return &TransactionService{
 		transactionSaver:    transactionSaver,
 		transactionProvider: transactionProvider,
+		catalogProvider:     catalogProvider,
 		log:                 log,
 	}
 }
 
-func (t *TransactionService) GetTransactions(ctx context.Context, username string) ([]models.Transaction, error) {
-	const op = "services.transactions.GetTransactions"
+var (
+	ErrItemNotFound    = errors.New("item not found")
+	ErrItemRetired     = errors.New("item is retired and can't be bought")
+	ErrPriceChanged    = errors.New("item price changed, retry the purchase")
+	ErrSoldOut         = errors.New("item is sold out")
+	ErrLimitReached    = errors.New("item purchase limit reached")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrNoCoins         = errors.New("not enough coins")
+	ErrInvalidAmount   = errors.New("amount must be positive")
+	ErrInvalidQuantity = errors.New("quantity must be between 1 and 100")
+	ErrInvalidFilter   = errors.New("invalid transaction filter")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrReasonRequired  = errors.New("reason is required")
+	ErrSelfTransfer    = errors.New("can't send coins to yourself")
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// ListTransactions returns one page of the user's transactions matching filter.
+// cursor is the NextCursor of the previous page, empty for the first page.
+func (t *TransactionService) ListTransactions(ctx context.Context, filter models.TransactionFilter, cursor string) (*models.TransactionPage, error) {
+	const op = "services.transactions.ListTransactions"
 	log := t.log.With(slog.String("op", op))
-	log.Info("getting transactions")
-	transactions, err := t.transactionProvider.GetTransactions(ctx, username)
-	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			log.Warn("user not found", err.Error())
-			return nil, fmt.Errorf("%s %w", op, ErrInvalidCredentials)
+	log.Info("listing transactions")
+	switch filter.Direction {
+	case "", models.DirectionSent, models.DirectionReceived, models.DirectionPurchase:
+	default:
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidFilter)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidFilter)
+	}
+	if filter.Limit < 0 || filter.Limit > maxPageLimit {
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidFilter)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultPageLimit
+	}
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			log.Warn("invalid cursor", sl.Err(err))
+			return nil, fmt.Errorf("%s %w", op, ErrInvalidCursor)
 		}
+		filter.After = after
+	}
+	limit := filter.Limit
+	filter.Limit++
+	transactions, err := t.transactionProvider.ListTransactions(ctx, filter)
+	if err != nil {
 		return nil, fmt.Errorf("%s %w", op, err)
 	}
-	return transactions, nil
+	page := &models.TransactionPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		last := page.Transactions[limit-1]
+		page.NextCursor = encodeCursor(models.TransactionCursor{CreatedAt: last.CreatedAt, Id: last.Id})
+	}
+	return page, nil
 }
 
-func (t *TransactionService) GetItems(ctx context.Context, username string) ([]string, error) {
-	const op = "services.transactions.GetItems"
+func encodeCursor(cursor models.TransactionCursor) string {
+	raw := strconv.FormatInt(cursor.CreatedAt.UnixNano(), 10) + ":" + strconv.Itoa(cursor.Id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (*models.TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errors.New("malformed cursor")
+	}
+	nanos, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	transactionId, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TransactionCursor{CreatedAt: time.Unix(0, nanos), Id: transactionId}, nil
+}
+
+func (t *TransactionService) GetInventory(ctx context.Context, username string) ([]models.InventoryItem, error) {
+	const op = "services.transactions.GetInventory"
 	log := t.log.With(slog.String("op", op))
-	log.Info("getting items")
-	items, err := t.transactionProvider.GetItems(ctx, username)
+	log.Info("getting inventory")
+	inventory, err := t.transactionProvider.GetInventory(ctx, username)
 	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			log.Warn("user not found", err.Error())
-			return nil, fmt.Errorf("%s %w", op, ErrInvalidCredentials)
-		}
 		return nil, fmt.Errorf("%s %w", op, err)
 	}
-	return items, nil
+	return inventory, nil
 }
 
-var (
-	itemList = map[string]int{
-		"t-shirt":    80,
-		"cup":        20,
-		"book":       50,
-		"pen":        10,
-		"powerbank":  200,
-		"hoody":      300,
-		"umbrella":   200,
-		"socks":      10,
-		"wallet":     50,
-		"pink-hoody": 500,
+func (t *TransactionService) GetCoinHistory(ctx context.Context, username string) (*models.CoinHistory, error) {
+	const op = "services.transactions.GetCoinHistory"
+	log := t.log.With(slog.String("op", op))
+	log.Info("getting coin history")
+	history, err := t.transactionProvider.GetCoinHistory(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
 	}
-)
+	return history, nil
+}
 
-func (t *TransactionService) SaveTransaction(ctx context.Context, sender, receiver, item string, amount int) (int, error) {
+// SaveTransaction sends amount coins from sender to receiver, or buys item
+// when it is set. key is the reserved idempotency key of the request or nil,
+// the same holds for Credit, Debit and BuyItem.
+func (t *TransactionService) SaveTransaction(ctx context.Context, sender, receiver, item string, amount int, key *models.IdempotencyKey) (int, error) {
 	const op = "services.transactions.SaveTransaction"
+	if item != "" {
+		receipt, err := t.BuyItem(ctx, sender, item, 1, key)
+		if err != nil {
+			return 0, fmt.Errorf("%s %w", op, err)
+		}
+		return receipt.TransactionId, nil
+	}
 	log := t.log.With(slog.String("op", op))
 	log.Info("saving transaction")
-	transaction := models.Transaction{
-		Sender:   sender,
-		Reciever: "",
-		Item:     item,
-		Amount:   amount,
+	if amount <= 0 {
+		return 0, fmt.Errorf("%s %w", op, ErrInvalidAmount)
 	}
-	if item != "" {
-		transaction.Amount = itemList[item]
+	if sender == receiver {
+		return 0, fmt.Errorf("%s %w", op, ErrSelfTransfer)
+	}
+	if storage.IsSystemAccount(receiver) {
+		return 0, fmt.Errorf("%s %w", op, ErrUserNotFound)
 	}
-	id, err := t.transactionSaver.SaveTransaction(ctx, transaction)
+	id, _, err := t.saveTransaction(ctx, log, models.Transaction{
+		Sender:         sender,
+		Reciever:       receiver,
+		Amount:         amount,
+		Quantity:       1,
+		IdempotencyKey: key,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", op, err)
+	}
+	return id, nil
+}
+
+// Credit issues amount coins from the bank to username on behalf of the admin actor.
+func (t *TransactionService) Credit(ctx context.Context, actor, username string, amount int, reason string, key *models.IdempotencyKey) (int, error) {
+	const op = "services.transactions.Credit"
+	id, err := t.adjustBalance(ctx, op, models.Transaction{
+		Sender:         storage.BankAccount,
+		Reciever:       username,
+		Amount:         amount,
+		Actor:          actor,
+		Reason:         reason,
+		IdempotencyKey: key,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", op, err)
+	}
+	return id, nil
+}
+
+// Debit returns amount coins from username to the bank on behalf of the admin actor.
+func (t *TransactionService) Debit(ctx context.Context, actor, username string, amount int, reason string, key *models.IdempotencyKey) (int, error) {
+	const op = "services.transactions.Debit"
+	id, err := t.adjustBalance(ctx, op, models.Transaction{
+		Sender:         username,
+		Reciever:       storage.BankAccount,
+		Amount:         amount,
+		Actor:          actor,
+		Reason:         reason,
+		IdempotencyKey: key,
+	})
 	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			log.Warn("user not found", err.Error())
-			return 0, fmt.Errorf("%s %w", op, ErrInvalidCredentials)
-		}
 		return 0, fmt.Errorf("%s %w", op, err)
 	}
 	return id, nil
 }
+
+func (t *TransactionService) adjustBalance(ctx context.Context, op string, transaction models.Transaction) (int, error) {
+	log := t.log.With(slog.String("op", op))
+	log.Info("adjusting balance", slog.String("actor", transaction.Actor), slog.Int("amount", transaction.Amount))
+	if transaction.Amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+	if strings.TrimSpace(transaction.Reason) == "" {
+		return 0, ErrReasonRequired
+	}
+	if storage.IsSystemAccount(transaction.Sender) && storage.IsSystemAccount(transaction.Reciever) {
+		return 0, ErrUserNotFound
+	}
+	transaction.Quantity = 1
+	id, _, err := t.saveTransaction(ctx, log, transaction)
+	return id, err
+}
+
+const maxPurchaseQuantity = 100
+
+func (t *TransactionService) BuyItem(ctx context.Context, username, item string, quantity int, key *models.IdempotencyKey) (*models.Receipt, error) {
+	const op = "services.transactions.BuyItem"
+	log := t.log.With(slog.String("op", op))
+	log.Info("buying item")
+	if quantity <= 0 || quantity > maxPurchaseQuantity {
+		return nil, fmt.Errorf("%s %w", op, ErrInvalidQuantity)
+	}
+	merch, err := t.catalogProvider.GetMerchItem(ctx, item)
+	if err != nil {
+		if errors.Is(err, storage.ErrItemNotFound) {
+			log.Warn("item not found", slog.String("item", item))
+			return nil, fmt.Errorf("%s %w", op, ErrItemNotFound)
+		}
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	if !merch.Available {
+		log.Warn("item is retired", slog.String("item", item))
+		return nil, fmt.Errorf("%s %w", op, ErrItemRetired)
+	}
+	// the storage checks availability and price again while the item is
+	// locked, a retire or price change may land in between
+	id, balance, err := t.saveTransaction(ctx, log, models.Transaction{
+		Sender:         username,
+		Reciever:       storage.ShopAccount,
+		Item:           merch.Name,
+		Quantity:       quantity,
+		Amount:         merch.Price * quantity,
+		IdempotencyKey: key,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return &models.Receipt{
+		TransactionId: id,
+		Item:          merch.Name,
+		Quantity:      quantity,
+		UnitPrice:     merch.Price,
+		Total:         merch.Price * quantity,
+		Balance:       balance,
+	}, nil
+}
+
+func (t *TransactionService) saveTransaction(ctx context.Context, log *slog.Logger, transaction models.Transaction) (int, int, error) {
+	id, balance, err := t.transactionSaver.SaveTransaction(ctx, transaction)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", sl.Err(err))
+			return 0, 0, ErrUserNotFound
+		}
+		if errors.Is(err, storage.ErrNoCoins) {
+			log.Warn("not enough coins", sl.Err(err))
+			return 0, 0, ErrNoCoins
+		}
+		if errors.Is(err, storage.ErrSoldOut) {
+			log.Warn("item is sold out", sl.Err(err))
+			return 0, 0, ErrSoldOut
+		}
+		if errors.Is(err, storage.ErrLimitReached) {
+			log.Warn("purchase limit reached", sl.Err(err))
+			return 0, 0, ErrLimitReached
+		}
+		if errors.Is(err, storage.ErrItemNotFound) {
+			return 0, 0, ErrItemNotFound
+		}
+		if errors.Is(err, storage.ErrItemRetired) {
+			log.Warn("item is retired", sl.Err(err))
+			return 0, 0, ErrItemRetired
+		}
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			// the reservation timed out and was taken over by a retry
+			log.Warn("idempotency key reservation lost", sl.Err(err))
+			return 0, 0, ErrKeyInProgress
+		}
+		if errors.Is(err, storage.ErrPriceChanged) {
+			log.Warn("item price changed", sl.Err(err))
+			return 0, 0, ErrPriceChanged
+		}
+		return 0, 0, err
+	}
+	return id, balance, nil
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+// SaveServiceAccount creates a user with the service role and no password.
+func (s *Storage) SaveServiceAccount(ctx context.Context, name string) (int, error) {
+	const op = "memory.storage.SaveServiceAccount"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[name]; ok {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+	}
+	s.lastUserId++
+	s.users[name] = &account{
+		user: models.User{Id: s.lastUserId, Username: name, Role: models.RoleService},
+	}
+	return s.lastUserId, nil
+}
+
+func (s *Storage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	const op = "memory.storage.SaveAPIKey"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[key.ServiceAccount]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	key.CreatedAt = time.Now()
+	key.Scopes = append([]string(nil), key.Scopes...)
+	s.apiKeys[key.Id] = key
+	return nil
+}
+
+func (s *Storage) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	const op = "memory.storage.GetAPIKey"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.apiKeys[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+	}
+	return &key, nil
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context, serviceAccount string) ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]models.APIKey, 0)
+	for _, key := range s.apiKeys {
+		if key.ServiceAccount == serviceAccount {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (s *Storage) RevokeAPIKey(ctx context.Context, serviceAccount, id string) error {
+	const op = "memory.storage.RevokeAPIKey"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.apiKeys[id]
+	if !ok || key.ServiceAccount != serviceAccount {
+		return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+	}
+	key.Revoked = true
+	s.apiKeys[id] = key
+	return nil
+}
+
+func (s *Storage) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.apiKeys[id]; ok {
+		key.LastUsedAt = &usedAt
+		s.apiKeys[id] = key
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+)
+
+// AttemptStore keeps failed login counters in process memory. Counters are
+// not shared between instances, each one throttles on its own.
+type AttemptStore struct {
+	mu        sync.Mutex
+	attempts  map[string]models.LoginAttempts
+	lastPrune time.Time
+}
+
+func NewAttemptStore() *AttemptStore {
+	return &AttemptStore{
+		attempts:  make(map[string]models.LoginAttempts),
+		lastPrune: time.Now(),
+	}
+}
+
+// TakeLoginAttempt counts an attempt for key as a failure unless lockedFor
+// reports a wait for the counter, then the wait is returned and nothing is
+// counted. Failures older than window are forgotten before counting.
+func (s *AttemptStore) TakeLoginAttempt(ctx context.Context, key string, window time.Duration, lockedFor func(models.LoginAttempts) time.Duration) (*models.LoginAttempt, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastPrune) > window {
+		for k, attempts := range s.attempts {
+			if now.Sub(attempts.LastFailure) > window {
+				delete(s.attempts, k)
+			}
+		}
+		s.lastPrune = now
+	}
+	attempts := s.attempts[key]
+	if wait := lockedFor(attempts); wait > 0 {
+		return nil, wait, nil
+	}
+	attempt := &models.LoginAttempt{Key: key, At: now, PreviousFailure: attempts.LastFailure}
+	if now.Sub(attempts.LastFailure) > window {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.LastFailure = now
+	s.attempts[key] = attempts
+	return attempt, 0, nil
+}
+
+// RefundLoginAttempt takes back an attempt counted by TakeLoginAttempt. The
+// last failure is only restored when no later attempt was counted.
+func (s *AttemptStore) RefundLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempts, ok := s.attempts[attempt.Key]
+	if !ok {
+		return nil
+	}
+	attempts.Failures--
+	if attempts.LastFailure.Equal(attempt.At) {
+		attempts.LastFailure = attempt.PreviousFailure
+	}
+	if attempts.Failures <= 0 {
+		delete(s.attempts, attempt.Key)
+		return nil
+	}
+	s.attempts[attempt.Key] = attempts
+	return nil
+}
+
+func (s *AttemptStore) ResetLoginAttempts(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Storage) GetMerchItem(ctx context.Context, name string) (*models.MerchItem, error) {
+	const op = "memory.storage.GetMerchItem"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	item, ok := s.items[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+	}
+	return &item, nil
+}
+
+func (s *Storage) ListMerchItems(ctx context.Context) ([]models.MerchItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make([]models.MerchItem, 0, len(s.items))
+	for _, item := range s.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
+
+func (s *Storage) SaveMerchItem(ctx context.Context, item models.MerchItem, actor string) (int, error) {
+	const op = "memory.storage.SaveMerchItem"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[item.Name]; ok {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrItemExists)
+	}
+	s.lastItemId++
+	item.Id = s.lastItemId
+	item.Available = true
+	s.items[item.Name] = item
+	s.prices[item.Name] = []models.MerchItemPrice{{Price: item.Price, ValidFrom: time.Now(), ChangedBy: actor}}
+	return item.Id, nil
+}
+
+// UpdateMerchItem changes the price, description and per-user limit of the
+// item with the given name, and its stock when setStock is true. A new price
+// version is recorded when the price changes.
+func (s *Storage) UpdateMerchItem(ctx context.Context, item models.MerchItem, setStock bool, actor string) error {
+	const op = "memory.storage.UpdateMerchItem"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.items[item.Name]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+	}
+	if stored.Price != item.Price {
+		s.prices[item.Name] = append(s.prices[item.Name], models.MerchItemPrice{Price: item.Price, ValidFrom: time.Now(), ChangedBy: actor})
+	}
+	stored.Price = item.Price
+	stored.Description = item.Description
+	stored.PerUserLimit = item.PerUserLimit
+	if setStock {
+		stored.Stock = item.Stock
+	}
+	s.items[item.Name] = stored
+	return nil
+}
+
+func (s *Storage) SetMerchItemAvailable(ctx context.Context, name string, available bool) error {
+	const op = "memory.storage.SetMerchItemAvailable"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[name]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+	}
+	item.Available = available
+	s.items[name] = item
+	return nil
+}
+
+func (s *Storage) GetMerchItemPrices(ctx context.Context, name string) ([]models.MerchItemPrice, error) {
+	const op = "memory.storage.GetMerchItemPrices"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	history, ok := s.prices[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+	}
+	prices := make([]models.MerchItemPrice, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		prices = append(prices, history[i])
+	}
+	return prices, nil
+}
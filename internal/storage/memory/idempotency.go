@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+type idempotencyKeyId struct {
+	username string
+	key      string
+}
+
+func (s *Storage) ReserveIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "memory.storage.ReserveIdempotencyKey"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := idempotencyKeyId{username: key.Username, key: key.Key}
+	if _, ok := s.idempotencyKeys[id]; ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyExists)
+	}
+	s.idempotencyKeys[id] = models.IdempotencyKey{
+		Username:    key.Username,
+		Key:         key.Key,
+		Fingerprint: key.Fingerprint,
+		CreatedAt:   time.Now(),
+		Attempt:     1,
+	}
+	return nil
+}
+
+func (s *Storage) GetIdempotencyKey(ctx context.Context, username, key string) (*models.IdempotencyKey, error) {
+	const op = "memory.storage.GetIdempotencyKey"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stored, ok := s.idempotencyKeys[idempotencyKeyId{username: username, key: key}]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+	return &stored, nil
+}
+
+// SaveIdempotencyResponse completes the reservation key.Attempt of the key.
+func (s *Storage) SaveIdempotencyResponse(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "memory.storage.SaveIdempotencyResponse"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := idempotencyKeyId{username: key.Username, key: key.Key}
+	stored, ok := s.idempotencyKeys[id]
+	if !ok || stored.Attempt != key.Attempt || stored.StatusCode != 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+	stored.StatusCode = key.StatusCode
+	stored.Response = key.Response
+	s.idempotencyKeys[id] = stored
+	return nil
+}
+
+// DeleteIdempotencyKey deletes the reservation key.Attempt of the key unless
+// it was completed or a transaction was posted with it.
+func (s *Storage) DeleteIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "memory.storage.DeleteIdempotencyKey"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := idempotencyKeyId{username: key.Username, key: key.Key}
+	if !s.isOpenReservation(id, key.Attempt) {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+	delete(s.idempotencyKeys, id)
+	return nil
+}
+
+// ReclaimIdempotencyKey takes over the reservation key.Attempt of a key that
+// was neither completed nor used to post a transaction.
+func (s *Storage) ReclaimIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "memory.storage.ReclaimIdempotencyKey"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := idempotencyKeyId{username: key.Username, key: key.Key}
+	if !s.isOpenReservation(id, key.Attempt) {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+	stored := s.idempotencyKeys[id]
+	stored.Attempt++
+	stored.CreatedAt = time.Now()
+	s.idempotencyKeys[id] = stored
+	return nil
+}
+
+// markIdempotencyKey records that the reservation key posted transactionId.
+// The caller must hold s.mu and check isOpenReservation first.
+func (s *Storage) markIdempotencyKey(key models.IdempotencyKey, transactionId int) {
+	id := idempotencyKeyId{username: key.Username, key: key.Key}
+	stored := s.idempotencyKeys[id]
+	stored.TransactionId = transactionId
+	s.idempotencyKeys[id] = stored
+}
+
+// isOpenReservation reports whether attempt is the current reservation of
+// the key and it was neither completed nor used. The caller must hold s.mu.
+func (s *Storage) isOpenReservation(id idempotencyKeyId, attempt int) bool {
+	stored, ok := s.idempotencyKeys[id]
+	return ok && stored.Attempt == attempt && stored.StatusCode == 0 && stored.TransactionId == 0
+}
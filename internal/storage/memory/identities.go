@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+type identityId struct {
+	issuer  string
+	subject string
+}
+
+func (s *Storage) SaveUserIdentity(ctx context.Context, identity models.UserIdentity) error {
+	const op = "memory.storage.SaveUserIdentity"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[identity.Username]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	id := identityId{issuer: identity.Issuer, subject: identity.Subject}
+	if _, ok := s.identities[id]; ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrIdentityExists)
+	}
+	identity.CreatedAt = time.Now()
+	s.identities[id] = identity
+	return nil
+}
+
+func (s *Storage) GetUserIdentity(ctx context.Context, issuer, subject string) (*models.UserIdentity, error) {
+	const op = "memory.storage.GetUserIdentity"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	identity, ok := s.identities[identityId{issuer: issuer, subject: subject}]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrIdentityNotFound)
+	}
+	return &identity, nil
+}
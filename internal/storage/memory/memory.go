@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+// Storage keeps all shop data in process memory. It implements the same
+// interfaces as postgres.Strorage and is meant for local runs and tests.
+type Storage struct {
+	mu              sync.RWMutex
+	users           map[string]*account
+	transactions    []models.Transaction
+	ledger          []ledgerEntry
+	items           map[string]models.MerchItem
+	prices          map[string][]models.MerchItemPrice
+	idempotencyKeys map[idempotencyKeyId]models.IdempotencyKey
+	sessions        map[string]models.Session
+	revokedTokens   map[string]time.Time
+	passwordResets  map[string]models.PasswordReset
+	identities      map[identityId]models.UserIdentity
+	apiKeys         map[string]models.APIKey
+	lastUserId      int
+	lastItemId      int
+}
+
+type account struct {
+	user   models.User
+	system bool
+}
+
+type ledgerEntry struct {
+	transactionId int
+	username      string
+	amount        int
+}
+
+var defaultCatalog = []models.MerchItem{
+	{Name: "t-shirt", Price: 80, Description: "Avito t-shirt"},
+	{Name: "cup", Price: 20, Description: "Mug with the Avito logo"},
+	{Name: "book", Price: 50, Description: "Notebook"},
+	{Name: "pen", Price: 10, Description: "Ballpoint pen"},
+	{Name: "powerbank", Price: 200, Description: "Portable charger"},
+	{Name: "hoody", Price: 300, Description: "Avito hoody"},
+	{Name: "umbrella", Price: 200, Description: "Umbrella"},
+	{Name: "socks", Price: 10, Description: "Pair of socks"},
+	{Name: "wallet", Price: 50, Description: "Leather wallet"},
+	{Name: "pink-hoody", Price: 500, Description: "Limited pink hoody"},
+}
+
+func New() *Storage {
+	s := &Storage{
+		users:           make(map[string]*account),
+		items:           make(map[string]models.MerchItem),
+		prices:          make(map[string][]models.MerchItemPrice),
+		sessions:        make(map[string]models.Session),
+		revokedTokens:   make(map[string]time.Time),
+		passwordResets:  make(map[string]models.PasswordReset),
+		identities:      make(map[identityId]models.UserIdentity),
+		apiKeys:         make(map[string]models.APIKey),
+		idempotencyKeys: make(map[idempotencyKeyId]models.IdempotencyKey),
+	}
+	for _, username := range []string{storage.ShopAccount, storage.BankAccount} {
+		s.lastUserId++
+		s.users[username] = &account{
+			user:   models.User{Id: s.lastUserId, Username: username},
+			system: true,
+		}
+	}
+	for _, item := range defaultCatalog {
+		s.lastItemId++
+		item.Id = s.lastItemId
+		item.Available = true
+		s.items[item.Name] = item
+		s.prices[item.Name] = []models.MerchItemPrice{{Price: item.Price, ValidFrom: time.Now()}}
+	}
+	return s
+}
+
+// SaveUser creates a user together with the welcomeGrant coins from the bank.
+func (s *Storage) SaveUser(ctx context.Context, username string, passHash []byte, welcomeGrant int) (int, error) {
+	const op = "memory.storage.SaveUser"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[username]; ok {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+	}
+	s.lastUserId++
+	user := &account{
+		user: models.User{Id: s.lastUserId, Username: username, PassHash: string(passHash), Role: models.RoleUser},
+	}
+	s.users[username] = user
+	if welcomeGrant > 0 {
+		grant := models.Transaction{
+			Sender:   storage.BankAccount,
+			Reciever: username,
+			Amount:   welcomeGrant,
+			Quantity: 1,
+		}
+		s.insertTransaction(grant, s.users[storage.BankAccount], user)
+	}
+	return s.lastUserId, nil
+}
+
+func (s *Storage) GetUser(ctx context.Context, username string) (*models.User, error) {
+	const op = "memory.storage.GetUser"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	acc, ok := s.users[username]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	user := acc.user
+	return &user, nil
+}
+
+func (s *Storage) SetUserRole(ctx context.Context, username, role string) error {
+	const op = "memory.storage.SetUserRole"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.users[username]
+	if !ok || acc.system {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	acc.user.Role = role
+	return nil
+}
+
+func (s *Storage) SetUserPassword(ctx context.Context, username string, passHash []byte) error {
+	const op = "memory.storage.SetUserPassword"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.users[username]
+	if !ok || acc.system {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	acc.user.PassHash = string(passHash)
+	return nil
+}
@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Storage) SavePasswordReset(ctx context.Context, reset models.PasswordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passwordResets[reset.TokenHash] = reset
+	return nil
+}
+
+func (s *Storage) GetPasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	const op = "memory.storage.GetPasswordReset"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	reset, ok := s.passwordResets[tokenHash]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrResetNotFound)
+	}
+	return &reset, nil
+}
+
+func (s *Storage) UsePasswordReset(ctx context.Context, tokenHash string) error {
+	const op = "memory.storage.UsePasswordReset"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reset, ok := s.passwordResets[tokenHash]
+	if !ok || reset.Used || !reset.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%s: %w", op, storage.ErrResetNotFound)
+	}
+	reset.Used = true
+	s.passwordResets[tokenHash] = reset
+	return nil
+}
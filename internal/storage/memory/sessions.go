@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Storage) SaveSession(ctx context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.CreatedAt = time.Now()
+	s.sessions[session.Id] = session
+	return nil
+}
+
+func (s *Storage) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	const op = "memory.storage.GetSession"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+	return &session, nil
+}
+
+func (s *Storage) RotateSession(ctx context.Context, id, refreshHash, newRefreshHash string, expiresAt time.Time) error {
+	const op = "memory.storage.RotateSession"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || session.RefreshHash != refreshHash || session.Revoked || !session.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+	session.RefreshHash = newRefreshHash
+	session.ExpiresAt = expiresAt
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, id string) error {
+	const op = "memory.storage.RevokeSession"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+	session.Revoked = true
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *Storage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, exp := range s.revokedTokens {
+		if exp.Before(now) {
+			delete(s.revokedTokens, id)
+		}
+	}
+	s.revokedTokens[jti] = expiresAt
+	return nil
+}
+
+func (s *Storage) IsTokenRevoked(ctx context.Context, jti, sessionId string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.revokedTokens[jti]; ok {
+		return true, nil
+	}
+	session, ok := s.sessions[sessionId]
+	return ok && session.Revoked, nil
+}
+
+func (s *Storage) RevokeUserSessions(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.sessions {
+		if session.Username == username {
+			session.Revoked = true
+			s.sessions[id] = session
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Storage) SaveTransaction(ctx context.Context, transaction models.Transaction) (int, int, error) {
+	const op = "memory.storage.SaveTransaction"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sender, ok := s.users[transaction.Sender]
+	if !ok {
+		return 0, 0, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	receiver, ok := s.users[transaction.Reciever]
+	if !ok {
+		return 0, 0, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	if !sender.system && sender.user.Coins < transaction.Amount {
+		return 0, 0, fmt.Errorf("%s: %w", op, storage.ErrNoCoins)
+	}
+	key := transaction.IdempotencyKey
+	if key != nil && !s.isOpenReservation(idempotencyKeyId{username: key.Username, key: key.Key}, key.Attempt) {
+		return 0, 0, fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+	if transaction.Item != "" {
+		if err := s.takeStock(transaction); err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	id := s.insertTransaction(transaction, sender, receiver)
+	if key != nil {
+		s.markIdempotencyKey(*key, id)
+	}
+	return id, sender.user.Coins, nil
+}
+
+// insertTransaction records transaction with its ledger entries and moves
+// the coins. The caller must hold s.mu and check the sender balance.
+func (s *Storage) insertTransaction(transaction models.Transaction, sender, receiver *account) int {
+	transaction.Id = len(s.transactions) + 1
+	transaction.CreatedAt = time.Now()
+	s.transactions = append(s.transactions, transaction)
+	s.ledger = append(s.ledger,
+		ledgerEntry{transactionId: transaction.Id, username: transaction.Sender, amount: -transaction.Amount},
+		ledgerEntry{transactionId: transaction.Id, username: transaction.Reciever, amount: transaction.Amount},
+	)
+	sender.user.Coins -= transaction.Amount
+	receiver.user.Coins += transaction.Amount
+	return transaction.Id
+}
+
+func (s *Storage) ListTransactions(ctx context.Context, filter models.TransactionFilter) ([]models.Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	transactions := make([]models.Transaction, 0, filter.Limit)
+	for i := len(s.transactions) - 1; i >= 0 && len(transactions) < filter.Limit; i-- {
+		if matchTransaction(s.transactions[i], filter) {
+			transactions = append(transactions, s.transactions[i])
+		}
+	}
+	return transactions, nil
+}
+
+func matchTransaction(transaction models.Transaction, filter models.TransactionFilter) bool {
+	sent := transaction.Sender == filter.Username
+	received := transaction.Reciever == filter.Username
+	purchase := transaction.Item != ""
+	switch filter.Direction {
+	case models.DirectionSent:
+		if !sent || purchase {
+			return false
+		}
+	case models.DirectionReceived:
+		if !received || purchase {
+			return false
+		}
+	case models.DirectionPurchase:
+		if !sent || !purchase {
+			return false
+		}
+	default:
+		if !sent && !received {
+			return false
+		}
+	}
+	if filter.Counterparty != "" {
+		if !(sent && transaction.Reciever == filter.Counterparty) && !(received && transaction.Sender == filter.Counterparty) {
+			return false
+		}
+	}
+	if filter.Item != "" && transaction.Item != filter.Item {
+		return false
+	}
+	if !filter.From.IsZero() && transaction.CreatedAt.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && !transaction.CreatedAt.Before(filter.To) {
+		return false
+	}
+	if after := filter.After; after != nil {
+		if transaction.CreatedAt.After(after.CreatedAt) ||
+			transaction.CreatedAt.Equal(after.CreatedAt) && transaction.Id >= after.Id {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Storage) GetInventory(ctx context.Context, username string) ([]models.InventoryItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	quantities := make(map[string]int)
+	for _, transaction := range s.transactions {
+		if transaction.Sender == username && transaction.Item != "" {
+			quantities[transaction.Item] += transaction.Quantity
+		}
+	}
+	inventory := make([]models.InventoryItem, 0, len(quantities))
+	for item, quantity := range quantities {
+		inventory = append(inventory, models.InventoryItem{Type: item, Quantity: quantity})
+	}
+	sort.Slice(inventory, func(i, j int) bool { return inventory[i].Type < inventory[j].Type })
+	return inventory, nil
+}
+
+func (s *Storage) GetCoinHistory(ctx context.Context, username string) (*models.CoinHistory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sent := make(map[string]int)
+	received := make(map[string]int)
+	for _, transaction := range s.transactions {
+		if transaction.Item != "" {
+			continue
+		}
+		if transaction.Sender == username {
+			sent[transaction.Reciever] += transaction.Amount
+		}
+		if transaction.Reciever == username {
+			received[transaction.Sender] += transaction.Amount
+		}
+	}
+	return &models.CoinHistory{
+		Received: coinTransfers(received),
+		Sent:     coinTransfers(sent),
+	}, nil
+}
+
+func coinTransfers(amounts map[string]int) []models.CoinTransfer {
+	transfers := make([]models.CoinTransfer, 0, len(amounts))
+	for user, amount := range amounts {
+		transfers = append(transfers, models.CoinTransfer{User: user, Amount: amount})
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].User < transfers[j].User })
+	return transfers
+}
+
+// takeStock checks that the purchased item is still available at the price
+// the amount was computed with, checks its stock and per-user limit and takes
+// the bought quantity out of stock. The caller must hold s.mu.
+func (s *Storage) takeStock(transaction models.Transaction) error {
+	item, ok := s.items[transaction.Item]
+	if !ok {
+		return storage.ErrItemNotFound
+	}
+	if !item.Available {
+		return storage.ErrItemRetired
+	}
+	if item.Price*transaction.Quantity != transaction.Amount {
+		return storage.ErrPriceChanged
+	}
+	if item.Stock != nil && *item.Stock < transaction.Quantity {
+		return storage.ErrSoldOut
+	}
+	if item.PerUserLimit != nil {
+		purchased := 0
+		for _, t := range s.transactions {
+			if t.Sender == transaction.Sender && t.Item == transaction.Item {
+				purchased += t.Quantity
+			}
+		}
+		if purchased+transaction.Quantity > *item.PerUserLimit {
+			return storage.ErrLimitReached
+		}
+	}
+	if item.Stock != nil {
+		stock := *item.Stock - transaction.Quantity
+		item.Stock = &stock
+		s.items[item.Name] = item
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+// checkLedger verifies the invariants of the double-entry ledger: every
+// transaction has entries summing to zero, every balance is the sum of its
+// entries, all balances sum to zero and only system accounts are negative.
+func checkLedger(t *testing.T, s *Storage) {
+	t.Helper()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	byTransaction := make(map[int]int)
+	byUser := make(map[string]int)
+	for _, entry := range s.ledger {
+		byTransaction[entry.transactionId] += entry.amount
+		byUser[entry.username] += entry.amount
+	}
+	if len(byTransaction) != len(s.transactions) {
+		t.Errorf("%d transactions have ledger entries, want %d", len(byTransaction), len(s.transactions))
+	}
+	for id, sum := range byTransaction {
+		if sum != 0 {
+			t.Errorf("entries of transaction %d sum to %d", id, sum)
+		}
+	}
+	total := 0
+	for username, acc := range s.users {
+		total += acc.user.Coins
+		if acc.user.Coins != byUser[username] {
+			t.Errorf("%s has %d coins, its entries sum to %d", username, acc.user.Coins, byUser[username])
+		}
+		if acc.user.Coins < 0 && !acc.system {
+			t.Errorf("%s has a negative balance %d", username, acc.user.Coins)
+		}
+	}
+	if total != 0 {
+		t.Errorf("balances sum to %d", total)
+	}
+}
+
+func TestLedgerInvariantsUnderConcurrentTransfers(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	users := make([]string, 5)
+	for i := range users {
+		users[i] = fmt.Sprintf("user%d", i)
+		if _, err := s.SaveUser(ctx, users[i], []byte("hash"), 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 200; i++ {
+				sender := users[rnd.Intn(len(users))]
+				transaction := models.Transaction{Sender: sender, Reciever: users[rnd.Intn(len(users))], Amount: 1 + rnd.Intn(40), Quantity: 1}
+				if rnd.Intn(3) == 0 {
+					quantity := 1 + rnd.Intn(3)
+					transaction = models.Transaction{Sender: sender, Reciever: storage.ShopAccount, Item: "pen", Amount: 10 * quantity, Quantity: quantity}
+				}
+				_, _, err := s.SaveTransaction(ctx, transaction)
+				if err != nil && !errors.Is(err, storage.ErrNoCoins) {
+					t.Errorf("SaveTransaction: %v", err)
+				}
+			}
+		}(int64(worker))
+	}
+	wg.Wait()
+	checkLedger(t, s)
+}
+
+func TestFailedTransactionLeavesNoEntries(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := s.SaveUser(ctx, username, []byte("hash"), 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := len(s.ledger)
+
+	if _, _, err := s.SaveTransaction(ctx, models.Transaction{Sender: "alice", Reciever: "bob", Amount: 101, Quantity: 1}); !errors.Is(err, storage.ErrNoCoins) {
+		t.Fatalf("overdraft = %v, want ErrNoCoins", err)
+	}
+	if _, _, err := s.SaveTransaction(ctx, models.Transaction{Sender: "alice", Reciever: "nobody", Amount: 1, Quantity: 1}); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Fatalf("transfer to an unknown user = %v, want ErrUserNotFound", err)
+	}
+	purchase := models.Transaction{Sender: "alice", Reciever: storage.ShopAccount, Item: "pen", Amount: 5, Quantity: 1}
+	if _, _, err := s.SaveTransaction(ctx, purchase); !errors.Is(err, storage.ErrPriceChanged) {
+		t.Fatalf("purchase at a stale price = %v, want ErrPriceChanged", err)
+	}
+	if len(s.ledger) != before {
+		t.Errorf("failed transactions added %d ledger entries", len(s.ledger)-before)
+	}
+	checkLedger(t, s)
+}
+
+func TestSaveTransactionReturnsSenderBalance(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	if _, err := s.SaveUser(ctx, "alice", []byte("hash"), 100); err != nil {
+		t.Fatal(err)
+	}
+	_, balance, err := s.SaveTransaction(ctx, models.Transaction{Sender: "alice", Reciever: storage.ShopAccount, Item: "pen", Amount: 30, Quantity: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 70 {
+		t.Errorf("balance = %d, want 70", balance)
+	}
+}
+
+func TestWelcomeGrantComesFromTheBank(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	if _, err := s.SaveUser(ctx, "alice", []byte("hash"), 100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveUser(ctx, "bob", []byte("hash"), 0); err != nil {
+		t.Fatal(err)
+	}
+	bank, err := s.GetUser(ctx, storage.BankAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bank.Coins != -100 {
+		t.Errorf("bank balance = %d, want -100", bank.Coins)
+	}
+	if len(s.transactions) != 1 {
+		t.Errorf("%d transactions, want only the grant of alice", len(s.transactions))
+	}
+	checkLedger(t, s)
+}
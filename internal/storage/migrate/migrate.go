@@ -0,0 +1,301 @@
+// Package migrate applies and rolls back versioned SQL migrations and
+// records the applied versions in the migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoMigrations = errors.New("storage driver has no migrations")
+
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator runs the migrations found in a directory of
+// <version>_<name>.up.sql and <version>_<name>.down.sql files.
+type Migrator struct {
+	db          *sql.DB
+	migrations  fs.FS
+	placeholder func(n int) string
+	lockQuery   string
+	unlockQuery string
+	// baselineQuery and baselineVersion are set by WithBaseline.
+	baselineQuery   string
+	baselineVersion int
+}
+
+const (
+	createMigrationsTableQuery = "CREATE TABLE IF NOT EXISTS migrations (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)"
+	getAppliedQuery            = "SELECT version, applied_at FROM migrations ORDER BY version"
+	countAppliedQuery          = "SELECT COUNT(*) FROM migrations"
+)
+
+// New returns a Migrator for db. placeholder renders the n-th query argument
+// in the SQL dialect of db, e.g. "$1" for postgres.
+func New(db *sql.DB, migrations fs.FS, placeholder func(n int) string) *Migrator {
+	return &Migrator{
+		db:          db,
+		migrations:  migrations,
+		placeholder: placeholder,
+	}
+}
+
+// WithLock makes Up and Down run lock before and unlock after they change
+// the schema, both on one dedicated connection. It keeps servers sharing a
+// database from applying the same migration at once on start.
+func (m *Migrator) WithLock(lock, unlock string) *Migrator {
+	m.lockQuery = lock
+	m.unlockQuery = unlock
+	return m
+}
+
+// WithBaseline makes Up record the migrations up to version as applied,
+// without running them, when none are recorded yet and exists, a query
+// returning one boolean, reports that the schema is already there. It
+// adopts databases created from the schema before migrations were tracked.
+func (m *Migrator) WithBaseline(exists string, version int) *Migrator {
+	m.baselineQuery = exists
+	m.baselineVersion = version
+	return m
+}
+
+// Up applies all pending migrations in version order and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	const op = "migrate.Up"
+	release, err := m.lock(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer release()
+	if err := m.baseline(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	applied := make([]Migration, 0)
+	for _, status := range statuses {
+		if status.Applied {
+			continue
+		}
+		insert := fmt.Sprintf("INSERT INTO migrations(version, name) VALUES(%s, %s)", m.placeholder(1), m.placeholder(2))
+		if err := m.run(ctx, status.up, insert, status.Version, status.Name); err != nil {
+			return applied, fmt.Errorf("%s: %06d_%s: %w", op, status.Version, status.Name, err)
+		}
+		applied = append(applied, status.Migration)
+	}
+	return applied, nil
+}
+
+// Down rolls back the last steps applied migrations and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	const op = "migrate.Down"
+	release, err := m.lock(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer release()
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	reverted := make([]Migration, 0, steps)
+	for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+		status := statuses[i]
+		if !status.Applied {
+			continue
+		}
+		if status.down == "" {
+			return reverted, fmt.Errorf("%s: %06d_%s has no down migration", op, status.Version, status.Name)
+		}
+		remove := fmt.Sprintf("DELETE FROM migrations WHERE version = %s", m.placeholder(1))
+		if err := m.run(ctx, status.down, remove, status.Version); err != nil {
+			return reverted, fmt.Errorf("%s: %06d_%s: %w", op, status.Version, status.Name, err)
+		}
+		reverted = append(reverted, status.Migration)
+	}
+	return reverted, nil
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	const op = "migrate.Status"
+	migrations, err := m.load()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := m.db.ExecContext(ctx, createMigrationsTableQuery); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	applied := make(map[int]time.Time)
+	rows, err := m.db.QueryContext(ctx, getAppliedQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	statuses := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// lock takes the lock set with WithLock and returns the function releasing it.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	if m.lockQuery == "" {
+		return func() {}, nil
+	}
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, m.lockQuery); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(context.WithoutCancel(ctx), m.unlockQuery)
+		conn.Close()
+	}, nil
+}
+
+// baseline records the migrations set with WithBaseline as applied if the
+// database has the schema but no recorded migrations.
+func (m *Migrator) baseline(ctx context.Context) error {
+	if m.baselineQuery == "" {
+		return nil
+	}
+	migrations, err := m.load()
+	if err != nil {
+		return err
+	}
+	if _, err := m.db.ExecContext(ctx, createMigrationsTableQuery); err != nil {
+		return err
+	}
+	var recorded int
+	if err := m.db.QueryRowContext(ctx, countAppliedQuery).Scan(&recorded); err != nil {
+		return err
+	}
+	if recorded > 0 {
+		return nil
+	}
+	var exists bool
+	if err := m.db.QueryRowContext(ctx, m.baselineQuery).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	insert := fmt.Sprintf("INSERT INTO migrations(version, name) VALUES(%s, %s)", m.placeholder(1), m.placeholder(2))
+	for _, migration := range migrations {
+		if migration.Version > m.baselineVersion {
+			break
+		}
+		if _, err := tx.ExecContext(ctx, insert, migration.Version, migration.Name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) run(ctx context.Context, script, record string, args ...any) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) load() ([]Migration, error) {
+	entries, err := fs.ReadDir(m.migrations, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		prefix, title, ok := strings.Cut(strings.TrimSuffix(name, "."+direction+".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("malformed migration file name %q", name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("malformed migration file name %q", name)
+		}
+		script, err := fs.ReadFile(m.migrations, name)
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: title}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.up = string(script)
+		} else {
+			migration.down = string(script)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" {
+			return nil, fmt.Errorf("migration %06d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
@@ -0,0 +1,86 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+)
+
+var testMigrations = fstest.MapFS{
+	"000001_init.up.sql":    {Data: []byte("CREATE TABLE users (username TEXT PRIMARY KEY)")},
+	"000001_init.down.sql":  {Data: []byte("DROP TABLE users")},
+	"000002_coins.up.sql":   {Data: []byte("ALTER TABLE users ADD COLUMN coins INTEGER NOT NULL DEFAULT 0")},
+	"000002_coins.down.sql": {Data: []byte("ALTER TABLE users DROP COLUMN coins")},
+}
+
+const usersExistQuery = "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'users'"
+
+func newTestMigrator(t *testing.T) (*sql.DB, *Migrator) {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, New(db, testMigrations, func(n int) string {
+		return "?" + strconv.Itoa(n)
+	}).WithBaseline(usersExistQuery, 1)
+}
+
+func versions(migrations []Migration) []int {
+	v := make([]int, 0, len(migrations))
+	for _, migration := range migrations {
+		v = append(v, migration.Version)
+	}
+	return v
+}
+
+func TestUpAdoptsExistingSchema(t *testing.T) {
+	ctx := context.Background()
+	db, m := newTestMigrator(t)
+	// a database created from the first schema before migrations were tracked
+	if _, err := db.Exec("CREATE TABLE users (username TEXT PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := versions(applied); len(v) != 1 || v[0] != 2 {
+		t.Fatalf("applied %v, want only 2", v)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			t.Errorf("%06d_%s is not recorded", status.Version, status.Name)
+		}
+	}
+}
+
+func TestUpRunsEveryMigrationOnAnEmptyDatabase(t *testing.T) {
+	ctx := context.Background()
+	_, m := newTestMigrator(t)
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := versions(applied); len(v) != 2 {
+		t.Fatalf("applied %v, want 1 and 2", v)
+	}
+	// with everything rolled back there is no schema to adopt
+	if _, err := m.Down(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if applied, err = m.Up(ctx); err != nil || len(applied) != 2 {
+		t.Fatalf("Up after Down applied %v: %v", versions(applied), err)
+	}
+}
@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+// SaveServiceAccount creates a user with the service role and no password.
+func (s *Strorage) SaveServiceAccount(ctx context.Context, name string) (int, error) {
+	const op = "postgres.storage.SaveServiceAccount"
+	var id int
+	if err := s.pool.QueryRow(ctx, saveServiceAccountQuery, name, models.RoleService).Scan(&id); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Strorage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	const op = "postgres.storage.SaveAPIKey"
+	_, err := s.pool.Exec(ctx, saveAPIKeyQuery, key.Id, key.ServiceAccount, key.KeyHash,
+		strings.Join(key.Scopes, " "), key.CreatedBy, key.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Strorage) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	const op = "postgres.storage.GetAPIKey"
+	key, err := scanAPIKey(s.pool.QueryRow(ctx, getAPIKeyQuery, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return key, nil
+}
+
+func (s *Strorage) ListAPIKeys(ctx context.Context, serviceAccount string) ([]models.APIKey, error) {
+	const op = "postgres.storage.ListAPIKeys"
+	rows, err := s.pool.Query(ctx, listAPIKeysQuery, serviceAccount)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return keys, nil
+}
+
+func (s *Strorage) RevokeAPIKey(ctx context.Context, serviceAccount, id string) error {
+	const op = "postgres.storage.RevokeAPIKey"
+	tag, err := s.pool.Exec(ctx, revokeAPIKeyQuery, id, serviceAccount)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+	}
+	return nil
+}
+
+func (s *Strorage) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	const op = "postgres.storage.TouchAPIKey"
+	if _, err := s.pool.Exec(ctx, touchAPIKeyQuery, id, usedAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	err := row.Scan(&key.Id, &key.ServiceAccount, &key.KeyHash, &scopes, &key.CreatedBy, &key.CreatedAt,
+		&key.ExpiresAt, &key.LastUsedAt, &key.Revoked)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	return &key, nil
+}
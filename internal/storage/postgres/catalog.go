@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Strorage) GetMerchItem(ctx context.Context, name string) (*models.MerchItem, error) {
+	const op = "postgres.storage.GetMerchItem"
+	var item models.MerchItem
+	err := s.pool.QueryRow(ctx, getMerchItemQuery, name).Scan(&item.Id, &item.Name, &item.Price, &item.Description, &item.Available, &item.Stock, &item.PerUserLimit)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &item, nil
+}
+
+func (s *Strorage) ListMerchItems(ctx context.Context) ([]models.MerchItem, error) {
+	const op = "postgres.storage.ListMerchItems"
+	items := make([]models.MerchItem, 0)
+	var item models.MerchItem
+	rows, err := s.pool.Query(ctx, listMerchItemsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&item.Id, &item.Name, &item.Price, &item.Description, &item.Available, &item.Stock, &item.PerUserLimit); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return items, nil
+}
+
+func (s *Strorage) SaveMerchItem(ctx context.Context, item models.MerchItem, actor string) (int, error) {
+	const op = "postgres.storage.SaveMerchItem"
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+	var id int
+	if err := tx.QueryRow(ctx, saveMerchItemQuery, item.Name, item.Price, item.Description, item.Stock, item.PerUserLimit).Scan(&id); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrItemExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := tx.Exec(ctx, saveMerchItemPriceQuery, id, item.Price, actor); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// UpdateMerchItem changes the price, description and per-user limit of the
+// item with the given name, and its stock when setStock is true. A new price
+// version is recorded when the price changes.
+func (s *Strorage) UpdateMerchItem(ctx context.Context, item models.MerchItem, setStock bool, actor string) error {
+	const op = "postgres.storage.UpdateMerchItem"
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+	var id, price int
+	if err := tx.QueryRow(ctx, lockMerchItemQuery, item.Name).Scan(&id, &price); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := tx.Exec(ctx, updateMerchItemQuery, id, item.Price, item.Description, item.PerUserLimit); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if setStock {
+		if _, err := tx.Exec(ctx, setMerchItemStockQuery, id, item.Stock); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if price != item.Price {
+		if _, err := tx.Exec(ctx, saveMerchItemPriceQuery, id, item.Price, actor); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Strorage) SetMerchItemAvailable(ctx context.Context, name string, available bool) error {
+	const op = "postgres.storage.SetMerchItemAvailable"
+	tag, err := s.pool.Exec(ctx, setMerchItemAvailableQuery, name, available)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+	}
+	return nil
+}
+
+func (s *Strorage) GetMerchItemPrices(ctx context.Context, name string) ([]models.MerchItemPrice, error) {
+	const op = "postgres.storage.GetMerchItemPrices"
+	prices := make([]models.MerchItemPrice, 0)
+	var price models.MerchItemPrice
+	rows, err := s.pool.Query(ctx, getMerchItemPricesQuery, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&price.Price, &price.ValidFrom, &price.ChangedBy); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		prices = append(prices, price)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+	}
+	return prices, nil
+}
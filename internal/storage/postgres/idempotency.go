@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Strorage) ReserveIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "postgres.storage.ReserveIdempotencyKey"
+	tag, err := s.pool.Exec(ctx, reserveKeyQuery, key.Username, key.Key, key.Fingerprint)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyExists)
+	}
+	return nil
+}
+
+func (s *Strorage) GetIdempotencyKey(ctx context.Context, username, key string) (*models.IdempotencyKey, error) {
+	const op = "postgres.storage.GetIdempotencyKey"
+	var res models.IdempotencyKey
+	err := s.pool.QueryRow(ctx, getKeyQuery, username, key).
+		Scan(&res.Username, &res.Key, &res.Fingerprint, &res.StatusCode, &res.Response, &res.CreatedAt, &res.Attempt, &res.TransactionId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &res, nil
+}
+
+// SaveIdempotencyResponse completes the reservation key.Attempt of the key.
+func (s *Strorage) SaveIdempotencyResponse(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "postgres.storage.SaveIdempotencyResponse"
+	tag, err := s.pool.Exec(ctx, saveKeyResponseQuery, key.Username, key.Key, key.Attempt, key.StatusCode, key.Response)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey deletes the reservation key.Attempt of the key unless
+// it was completed or a transaction was posted with it.
+func (s *Strorage) DeleteIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "postgres.storage.DeleteIdempotencyKey"
+	tag, err := s.pool.Exec(ctx, deleteKeyQuery, key.Username, key.Key, key.Attempt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+	return nil
+}
+
+// ReclaimIdempotencyKey takes over the reservation key.Attempt of a key that
+// was neither completed nor used to post a transaction.
+func (s *Strorage) ReclaimIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "postgres.storage.ReclaimIdempotencyKey"
+	tag, err := s.pool.Exec(ctx, reclaimKeyQuery, key.Username, key.Key, key.Attempt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+	return nil
+}
+
+// markIdempotencyKey records that the reservation key posted transactionId.
+// It fails if the reservation was taken over or already used.
+func markIdempotencyKey(ctx context.Context, tx pgx.Tx, key models.IdempotencyKey, transactionId int) error {
+	tag, err := tx.Exec(ctx, markKeyQuery, key.Username, key.Key, key.Attempt, transactionId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrKeyNotFound
+	}
+	return nil
+}
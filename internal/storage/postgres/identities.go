@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Strorage) SaveUserIdentity(ctx context.Context, identity models.UserIdentity) error {
+	const op = "postgres.storage.SaveUserIdentity"
+	if _, err := s.pool.Exec(ctx, saveUserIdentityQuery, identity.Issuer, identity.Subject, identity.Username); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+			return fmt.Errorf("%s: %w", op, storage.ErrIdentityExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Strorage) GetUserIdentity(ctx context.Context, issuer, subject string) (*models.UserIdentity, error) {
+	const op = "postgres.storage.GetUserIdentity"
+	var identity models.UserIdentity
+	err := s.pool.QueryRow(ctx, getUserIdentityQuery, issuer, subject).
+		Scan(&identity.Issuer, &identity.Subject, &identity.Username, &identity.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrIdentityNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &identity, nil
+}
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Strorage) SavePasswordReset(ctx context.Context, reset models.PasswordReset) error {
+	const op = "postgres.storage.SavePasswordReset"
+	if _, err := s.pool.Exec(ctx, savePasswordResetQuery, reset.TokenHash, reset.Username, reset.CreatedBy, reset.ExpiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Strorage) GetPasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	const op = "postgres.storage.GetPasswordReset"
+	var reset models.PasswordReset
+	err := s.pool.QueryRow(ctx, getPasswordResetQuery, tokenHash).
+		Scan(&reset.TokenHash, &reset.Username, &reset.CreatedBy, &reset.ExpiresAt, &reset.Used)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrResetNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &reset, nil
+}
+
+// UsePasswordReset marks an unused, unexpired reset as used. It fails with
+// storage.ErrResetNotFound otherwise, so a token can be redeemed only once.
+func (s *Strorage) UsePasswordReset(ctx context.Context, tokenHash string) error {
+	const op = "postgres.storage.UsePasswordReset"
+	tag, err := s.pool.Exec(ctx, usePasswordResetQuery, tokenHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrResetNotFound)
+	}
+	return nil
+}
@@ -2,25 +2,77 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sync"
+	"strconv"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/splashk1e/avito-shop/internal/models"
 	"github.com/splashk1e/avito-shop/internal/storage"
+	"github.com/splashk1e/avito-shop/internal/storage/migrate"
+	"github.com/splashk1e/avito-shop/schema"
 )
 
 type Strorage struct {
 	pool *pgxpool.Pool
-	mu   sync.RWMutex
 }
 
+const uniqueViolationCode = "23505"
+
 const (
-	saveUserQuery        = "INSERT INTO users(username, pass_hash) VALUES($1, $2) RETURNING id"
-	getUserQuery         = "SELECT id, username, pass_hash FROM users WHERE username = $1"
-	saveTransactionQuery = "INSERT INTO transactions(sender, reciever, amount, item) VALUES($1, $2, $3, $4) RETURNING id"
-	getTransactionsQuery = "SELECT id, sender, reciever, amount, item FROM transactions WHERE sender = $1 OR reciever = $1"
-	getItemsQuery        = "SELECT item FROM transactions WHERE sender = $1 AND reciever=NULL"
+	saveUserQuery              = "INSERT INTO users(username, pass_hash) VALUES($1, $2) RETURNING id"
+	getUserQuery               = "SELECT id, username, pass_hash, coins, role FROM users WHERE username = $1"
+	lockAccountsQuery          = "SELECT username, coins, system FROM users WHERE username = ANY($1) ORDER BY username FOR UPDATE"
+	updateBalanceQuery         = "UPDATE users SET coins = coins + $2 WHERE username = $1 RETURNING coins"
+	saveTransactionQuery       = "INSERT INTO transactions(sender, receiver, amount, item, quantity, actor, reason) VALUES($1, $2, $3, NULLIF($4, ''), $5, NULLIF($6, ''), NULLIF($7, '')) RETURNING id"
+	saveLedgerEntryQuery       = "INSERT INTO ledger_entries(transaction_id, username, amount) VALUES($1, $2, $3)"
+	getInventoryQuery          = "SELECT item, SUM(quantity) FROM transactions WHERE sender = $1 AND item IS NOT NULL GROUP BY item ORDER BY item"
+	getMerchItemQuery          = "SELECT id, name, price, description, available, stock, per_user_limit FROM merch_items WHERE name = $1"
+	listMerchItemsQuery        = "SELECT id, name, price, description, available, stock, per_user_limit FROM merch_items ORDER BY name"
+	reserveKeyQuery            = "INSERT INTO idempotency_keys(username, key, fingerprint) VALUES($1, $2, $3) ON CONFLICT DO NOTHING"
+	getKeyQuery                = "SELECT username, key, fingerprint, COALESCE(status_code, 0), response, created_at, attempt, COALESCE(transaction_id, 0) FROM idempotency_keys WHERE username = $1 AND key = $2"
+	saveKeyResponseQuery       = "UPDATE idempotency_keys SET status_code = $4, response = $5 WHERE username = $1 AND key = $2 AND attempt = $3 AND status_code IS NULL"
+	deleteKeyQuery             = "DELETE FROM idempotency_keys WHERE username = $1 AND key = $2 AND attempt = $3 AND status_code IS NULL AND transaction_id IS NULL"
+	reclaimKeyQuery            = "UPDATE idempotency_keys SET attempt = attempt + 1, created_at = NOW() WHERE username = $1 AND key = $2 AND attempt = $3 AND status_code IS NULL AND transaction_id IS NULL"
+	markKeyQuery               = "UPDATE idempotency_keys SET transaction_id = $4 WHERE username = $1 AND key = $2 AND attempt = $3 AND status_code IS NULL AND transaction_id IS NULL"
+	getCoinHistoryQuery        = "SELECT 'sent', receiver, SUM(amount) FROM transactions WHERE sender = $1 AND item IS NULL GROUP BY receiver UNION ALL SELECT 'received', sender, SUM(amount) FROM transactions WHERE receiver = $1 AND item IS NULL GROUP BY sender ORDER BY 2"
+	setUserRoleQuery           = "UPDATE users SET role = $2 WHERE username = $1 AND NOT system"
+	saveMerchItemQuery         = "INSERT INTO merch_items(name, price, description, stock, per_user_limit) VALUES($1, $2, $3, $4, $5) RETURNING id"
+	lockMerchItemQuery         = "SELECT id, price FROM merch_items WHERE name = $1 FOR UPDATE"
+	updateMerchItemQuery       = "UPDATE merch_items SET price = $2, description = $3, per_user_limit = $4 WHERE id = $1"
+	setMerchItemAvailableQuery = "UPDATE merch_items SET available = $2 WHERE name = $1"
+	saveMerchItemPriceQuery    = "INSERT INTO merch_item_prices(item_id, price, changed_by) VALUES($1, $2, NULLIF($3, ''))"
+	getMerchItemPricesQuery    = "SELECT p.price, p.valid_from, COALESCE(p.changed_by, '') FROM merch_item_prices p JOIN merch_items i ON i.id = p.item_id WHERE i.name = $1 ORDER BY p.valid_from DESC, p.id DESC"
+	lockPurchaseItemQuery      = "SELECT available, price, stock, per_user_limit FROM merch_items WHERE name = $1 FOR UPDATE"
+	countPurchasedQuery        = "SELECT COALESCE(SUM(quantity), 0) FROM transactions WHERE sender = $1 AND item = $2"
+	takeStockQuery             = "UPDATE merch_items SET stock = stock - $2 WHERE name = $1 AND stock IS NOT NULL"
+	setMerchItemStockQuery     = "UPDATE merch_items SET stock = $2 WHERE id = $1"
+	saveSessionQuery           = "INSERT INTO sessions(id, username, refresh_hash, expires_at) VALUES($1, $2, $3, $4)"
+	getSessionQuery            = "SELECT id, username, refresh_hash, expires_at, created_at, revoked FROM sessions WHERE id = $1"
+	rotateSessionQuery         = "UPDATE sessions SET refresh_hash = $3, expires_at = $4 WHERE id = $1 AND refresh_hash = $2 AND NOT revoked AND expires_at > NOW()"
+	revokeSessionQuery         = "UPDATE sessions SET revoked = TRUE WHERE id = $1"
+	revokeTokenQuery           = "INSERT INTO revoked_tokens(jti, expires_at) VALUES($1, $2) ON CONFLICT DO NOTHING"
+	pruneRevokedTokensQuery    = "DELETE FROM revoked_tokens WHERE expires_at < NOW()"
+	isTokenRevokedQuery        = "SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1) OR EXISTS(SELECT 1 FROM sessions WHERE id = $2 AND revoked)"
+	setUserPasswordQuery       = "UPDATE users SET pass_hash = $2 WHERE username = $1 AND NOT system"
+	revokeUserSessionsQuery    = "UPDATE sessions SET revoked = TRUE WHERE username = $1 AND NOT revoked"
+	savePasswordResetQuery     = "INSERT INTO password_resets(token_hash, username, created_by, expires_at) VALUES($1, $2, NULLIF($3, ''), $4)"
+	getPasswordResetQuery      = "SELECT token_hash, username, COALESCE(created_by, ''), expires_at, used FROM password_resets WHERE token_hash = $1"
+	usePasswordResetQuery      = "UPDATE password_resets SET used = TRUE WHERE token_hash = $1 AND NOT used AND expires_at > NOW()"
+	saveUserIdentityQuery      = "INSERT INTO user_identities(issuer, subject, username) VALUES($1, $2, $3)"
+	getUserIdentityQuery       = "SELECT issuer, subject, username, created_at FROM user_identities WHERE issuer = $1 AND subject = $2"
+	saveServiceAccountQuery    = "INSERT INTO users(username, pass_hash, role) VALUES($1, '', $2) RETURNING id"
+	saveAPIKeyQuery            = "INSERT INTO api_keys(id, service_account, key_hash, scopes, created_by, expires_at) VALUES($1, $2, $3, $4, NULLIF($5, ''), $6)"
+	getAPIKeyQuery             = "SELECT id, service_account, key_hash, scopes, COALESCE(created_by, ''), created_at, expires_at, last_used_at, revoked FROM api_keys WHERE id = $1"
+	listAPIKeysQuery           = "SELECT id, service_account, key_hash, scopes, COALESCE(created_by, ''), created_at, expires_at, last_used_at, revoked FROM api_keys WHERE service_account = $1 ORDER BY created_at, id"
+	revokeAPIKeyQuery          = "UPDATE api_keys SET revoked = TRUE WHERE id = $1 AND service_account = $2"
+	touchAPIKeyQuery           = "UPDATE api_keys SET last_used_at = $2 WHERE id = $1"
+	migrationLockQuery         = "SELECT pg_advisory_lock(hashtext('avito-shop.migrations'))"
+	migrationUnlockQuery       = "SELECT pg_advisory_unlock(hashtext('avito-shop.migrations'))"
+	schemaExistsQuery          = "SELECT to_regclass('users') IS NOT NULL"
 )
 
 func New(ctx context.Context, storagePath string) *Strorage {
@@ -33,28 +85,39 @@ func New(ctx context.Context, storagePath string) *Strorage {
 	}
 	return &Strorage{
 		pool: pool,
-		mu:   sync.RWMutex{},
 	}
 }
 
-func (s *Strorage) SaveUser(ctx context.Context, username string, passHash []byte) (int, error) {
+// SaveUser creates a user and grants welcomeGrant coins from the bank in the
+// same database transaction, so no user is left without the grant.
+func (s *Strorage) SaveUser(ctx context.Context, username string, passHash []byte, welcomeGrant int) (int, error) {
 	const op = "postgres.storage.SaveUser"
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	var id int
-	if user, _ := s.GetUser(ctx, username); user != nil {
-		return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
-	}
-	row, err := s.pool.Query(ctx, saveUserQuery, username, passHash)
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback(ctx)
 
-	defer row.Conn()
-	if !row.Next() {
+	var id int
+	if err := tx.QueryRow(ctx, saveUserQuery, username, passHash).Scan(&id); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	if err := row.Scan(&id); err != nil {
+	if welcomeGrant > 0 {
+		grant := models.Transaction{
+			Sender:   storage.BankAccount,
+			Reciever: username,
+			Amount:   welcomeGrant,
+			Quantity: 1,
+		}
+		if _, _, err := insertTransaction(ctx, tx, grant); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 	return id, nil
@@ -63,17 +126,44 @@ func (s *Strorage) SaveUser(ctx context.Context, username string, passHash []byt
 func (s *Strorage) GetUser(ctx context.Context, username string) (*models.User, error) {
 	const op = "postgres.storage.GetUser"
 	var user models.User
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	row, err := s.pool.Query(ctx, getUserQuery, username)
+	err := s.pool.QueryRow(ctx, getUserQuery, username).Scan(&user.Id, &user.Username, &user.PassHash, &user.Coins, &user.Role)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	if !row.Next() {
-		return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	return &user, nil
+}
+
+func (s *Strorage) SetUserRole(ctx context.Context, username, role string) error {
+	const op = "postgres.storage.SetUserRole"
+	tag, err := s.pool.Exec(ctx, setUserRoleQuery, username, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 	}
-	if err := row.Scan(&user.Id, &user.Username, &user.PassHash); err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+	return nil
+}
+
+func (s *Strorage) SetUserPassword(ctx context.Context, username string, passHash []byte) error {
+	const op = "postgres.storage.SetUserPassword"
+	tag, err := s.pool.Exec(ctx, setUserPasswordQuery, username, passHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
-	return &user, nil
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	return nil
+}
+
+// Migrator adopts databases created by docker's initdb from the first
+// schema, they have its tables but no migrations table.
+func (s *Strorage) Migrator() *migrate.Migrator {
+	return migrate.New(stdlib.OpenDBFromPool(s.pool), schema.Postgres, func(n int) string {
+		return "$" + strconv.Itoa(n)
+	}).WithLock(migrationLockQuery, migrationUnlockQuery).WithBaseline(schemaExistsQuery, 1)
 }
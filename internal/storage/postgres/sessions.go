@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Strorage) SaveSession(ctx context.Context, session models.Session) error {
+	const op = "postgres.storage.SaveSession"
+	if _, err := s.pool.Exec(ctx, saveSessionQuery, session.Id, session.Username, session.RefreshHash, session.ExpiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Strorage) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	const op = "postgres.storage.GetSession"
+	var session models.Session
+	err := s.pool.QueryRow(ctx, getSessionQuery, id).
+		Scan(&session.Id, &session.Username, &session.RefreshHash, &session.ExpiresAt, &session.CreatedAt, &session.Revoked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &session, nil
+}
+
+// RotateSession replaces the refresh token hash of a live session. It fails
+// with storage.ErrSessionNotFound if refreshHash is no longer the current one,
+// so only one of two concurrent refreshes with the same token succeeds.
+func (s *Strorage) RotateSession(ctx context.Context, id, refreshHash, newRefreshHash string, expiresAt time.Time) error {
+	const op = "postgres.storage.RotateSession"
+	tag, err := s.pool.Exec(ctx, rotateSessionQuery, id, refreshHash, newRefreshHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+	return nil
+}
+
+func (s *Strorage) RevokeSession(ctx context.Context, id string) error {
+	const op = "postgres.storage.RevokeSession"
+	tag, err := s.pool.Exec(ctx, revokeSessionQuery, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+	return nil
+}
+
+func (s *Strorage) RevokeUserSessions(ctx context.Context, username string) error {
+	const op = "postgres.storage.RevokeUserSessions"
+	if _, err := s.pool.Exec(ctx, revokeUserSessionsQuery, username); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RevokeToken puts an access token id on the revocation list until the token
+// expires. Entries of already expired tokens are pruned on the way.
+func (s *Strorage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	const op = "postgres.storage.RevokeToken"
+	if _, err := s.pool.Exec(ctx, pruneRevokedTokensQuery); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := s.pool.Exec(ctx, revokeTokenQuery, jti, expiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Strorage) IsTokenRevoked(ctx context.Context, jti, sessionId string) (bool, error) {
+	const op = "postgres.storage.IsTokenRevoked"
+	var revoked bool
+	if err := s.pool.QueryRow(ctx, isTokenRevokedQuery, jti, sessionId).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return revoked, nil
+}
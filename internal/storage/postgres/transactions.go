@@ -4,74 +4,263 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/splashk1e/avito-shop/internal/models"
 	"github.com/splashk1e/avito-shop/internal/storage"
 )
 
-func (s *Strorage) GetTransactions(ctx context.Context, username string) ([]models.Transaction, error) {
-	const op = "postgres.storage.GetTransactions"
-	transactions := make([]models.Transaction, 0)
+func (s *Strorage) ListTransactions(ctx context.Context, filter models.TransactionFilter) ([]models.Transaction, error) {
+	const op = "postgres.storage.ListTransactions"
+	query, args := listTransactionsQuery(filter)
+	transactions := make([]models.Transaction, 0, filter.Limit)
 	var transaction models.Transaction
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	rows, err := s.pool.Query(ctx, getTransactionsQuery, username)
+	rows, err := s.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer rows.Close()
 	for rows.Next() {
-		if err := rows.Scan(&transaction.Id, &transaction.Sender, &transaction.Reciever, &transaction.Amount, &transaction.Item); err != nil {
+		if err := rows.Scan(&transaction.Id, &transaction.Sender, &transaction.Reciever, &transaction.Amount,
+			&transaction.Item, &transaction.Quantity, &transaction.CreatedAt, &transaction.Actor, &transaction.Reason); err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 		transactions = append(transactions, transaction)
 	}
-	if len(transactions) == 0 {
-		return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	return transactions, nil
 }
 
-func (s *Strorage) GetItems(ctx context.Context, username string) ([]string, error) {
-	const op = "postgres.storage.GetItems"
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	items := make([]string, 0)
-	var item string
-	rows, err := s.pool.Query(ctx, getItemsQuery, username)
+func listTransactionsQuery(filter models.TransactionFilter) (string, []any) {
+	var query strings.Builder
+	args := []any{filter.Username}
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	query.WriteString("SELECT id, sender, receiver, amount, COALESCE(item, ''), quantity, created_at, COALESCE(actor, ''), COALESCE(reason, '') FROM transactions WHERE ")
+	switch filter.Direction {
+	case models.DirectionSent:
+		query.WriteString("sender = $1 AND item IS NULL")
+	case models.DirectionReceived:
+		query.WriteString("receiver = $1 AND item IS NULL")
+	case models.DirectionPurchase:
+		query.WriteString("sender = $1 AND item IS NOT NULL")
+	default:
+		query.WriteString("(sender = $1 OR receiver = $1)")
+	}
+	if filter.Counterparty != "" {
+		p := arg(filter.Counterparty)
+		query.WriteString(" AND ((sender = $1 AND receiver = " + p + ") OR (receiver = $1 AND sender = " + p + "))")
+	}
+	if filter.Item != "" {
+		query.WriteString(" AND item = " + arg(filter.Item))
+	}
+	if !filter.From.IsZero() {
+		query.WriteString(" AND created_at >= " + arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		query.WriteString(" AND created_at < " + arg(filter.To))
+	}
+	if filter.After != nil {
+		query.WriteString(" AND (created_at, id) < (" + arg(filter.After.CreatedAt) + ", " + arg(filter.After.Id) + ")")
+	}
+	query.WriteString(" ORDER BY created_at DESC, id DESC LIMIT " + arg(filter.Limit))
+	return query.String(), args
+}
+
+func (s *Strorage) GetInventory(ctx context.Context, username string) ([]models.InventoryItem, error) {
+	const op = "postgres.storage.GetInventory"
+	inventory := make([]models.InventoryItem, 0)
+	var item models.InventoryItem
+	rows, err := s.pool.Query(ctx, getInventoryQuery, username)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer rows.Close()
 	for rows.Next() {
-		if err := rows.Scan(&item); err != nil {
+		if err := rows.Scan(&item.Type, &item.Quantity); err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
-		items = append(items, item)
+		inventory = append(inventory, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	return items, nil
+	return inventory, nil
 }
 
-func (s *Strorage) SaveTransaction(ctx context.Context, transaction models.Transaction) (int, error) {
-	const op = "postgres.storage.SaveTransactions"
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *Strorage) GetCoinHistory(ctx context.Context, username string) (*models.CoinHistory, error) {
+	const op = "postgres.storage.GetCoinHistory"
+	history := models.CoinHistory{
+		Received: make([]models.CoinTransfer, 0),
+		Sent:     make([]models.CoinTransfer, 0),
+	}
+	rows, err := s.pool.Query(ctx, getCoinHistoryQuery, username)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var direction string
+		var transfer models.CoinTransfer
+		if err := rows.Scan(&direction, &transfer.User, &transfer.Amount); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if direction == "sent" {
+			history.Sent = append(history.Sent, transfer)
+		} else {
+			history.Received = append(history.Received, transfer)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &history, nil
+}
+
+type account struct {
+	coins  int
+	system bool
+}
+
+// SaveTransaction moves transaction.Amount coins from the sender to the receiver
+// in a single database transaction. Both accounts are locked in username order,
+// the sender balance is checked, and a debit and a credit ledger entry are
+// written next to the transaction so the entries always sum to zero. It
+// returns the transaction id and the sender balance the transaction left.
+func (s *Strorage) SaveTransaction(ctx context.Context, transaction models.Transaction) (int, int, error) {
+	const op = "postgres.storage.SaveTransaction"
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	accounts, err := lockAccounts(ctx, tx, transaction.Sender, transaction.Reciever)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	sender, ok := accounts[transaction.Sender]
+	if !ok {
+		return 0, 0, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	if _, ok := accounts[transaction.Reciever]; !ok {
+		return 0, 0, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	if !sender.system && sender.coins < transaction.Amount {
+		return 0, 0, fmt.Errorf("%s: %w", op, storage.ErrNoCoins)
+	}
+	if transaction.Item != "" {
+		if err := takeStock(ctx, tx, transaction); err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	id, balance, err := insertTransaction(ctx, tx, transaction)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if transaction.IdempotencyKey != nil {
+		if err := markIdempotencyKey(ctx, tx, *transaction.IdempotencyKey, id); err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, balance, nil
+}
 
+// insertTransaction writes transaction with its debit and credit ledger
+// entries and updates both balances, the caller checks the sender balance.
+// It returns the transaction id and the new sender balance.
+func insertTransaction(ctx context.Context, tx pgx.Tx, transaction models.Transaction) (int, int, error) {
 	var id int
-	user, err := s.GetUser(ctx, transaction.Reciever)
-	if errors.Is(err, storage.ErrUserNotFound) && transaction.Item != "" {
-		return 0, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	err := tx.QueryRow(ctx, saveTransactionQuery, transaction.Sender, transaction.Reciever, transaction.Amount, transaction.Item, transaction.Quantity, transaction.Actor, transaction.Reason).Scan(&id)
+	if err != nil {
+		return 0, 0, err
+	}
+	balance, err := postEntry(ctx, tx, id, transaction.Sender, -transaction.Amount)
+	if err != nil {
+		return 0, 0, err
 	}
-	if transaction.Amount > user.Coins {
-		return 0, fmt.Errorf("%s: %w", op, storage.ErrNoCoins)
+	if _, err := postEntry(ctx, tx, id, transaction.Reciever, transaction.Amount); err != nil {
+		return 0, 0, err
 	}
-	row, err := s.pool.Query(ctx, saveTransactionQuery, transaction.Sender, transaction.Reciever, transaction.Amount, transaction.Item)
+	return id, balance, nil
+}
+
+func lockAccounts(ctx context.Context, tx pgx.Tx, usernames ...string) (map[string]account, error) {
+	accounts := make(map[string]account, len(usernames))
+	rows, err := tx.Query(ctx, lockAccountsQuery, usernames)
 	if err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
-	if row.Next() {
-		return 0, fmt.Errorf("%s: %w", op, err)
+	defer rows.Close()
+	for rows.Next() {
+		var username string
+		var acc account
+		if err := rows.Scan(&username, &acc.coins, &acc.system); err != nil {
+			return nil, err
+		}
+		accounts[username] = acc
+	}
+	return accounts, rows.Err()
+}
+
+// takeStock checks that the purchased item is still available at the price
+// the amount was computed with, checks its stock and per-user limit and takes
+// the bought quantity out of stock. The merch row stays locked
+// until the transaction ends, the sender row is already locked by lockAccounts.
+func takeStock(ctx context.Context, tx pgx.Tx, transaction models.Transaction) error {
+	var available bool
+	var price int
+	var stock, limit *int
+	if err := tx.QueryRow(ctx, lockPurchaseItemQuery, transaction.Item).Scan(&available, &price, &stock, &limit); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storage.ErrItemNotFound
+		}
+		return err
+	}
+	if !available {
+		return storage.ErrItemRetired
+	}
+	if price*transaction.Quantity != transaction.Amount {
+		return storage.ErrPriceChanged
+	}
+	if stock != nil && *stock < transaction.Quantity {
+		return storage.ErrSoldOut
+	}
+	if limit != nil {
+		var purchased int
+		if err := tx.QueryRow(ctx, countPurchasedQuery, transaction.Sender, transaction.Item).Scan(&purchased); err != nil {
+			return err
+		}
+		if purchased+transaction.Quantity > *limit {
+			return storage.ErrLimitReached
+		}
+	}
+	if stock != nil {
+		if _, err := tx.Exec(ctx, takeStockQuery, transaction.Item, transaction.Quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postEntry writes a ledger entry and returns the balance it left.
+func postEntry(ctx context.Context, tx pgx.Tx, transactionId int, username string, amount int) (int, error) {
+	if _, err := tx.Exec(ctx, saveLedgerEntryQuery, transactionId, username, amount); err != nil {
+		return 0, err
 	}
-	if err := row.Scan(&id); err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
+	var balance int
+	if err := tx.QueryRow(ctx, updateBalanceQuery, username, amount).Scan(&balance); err != nil {
+		return 0, err
 	}
-	return id, nil
+	return balance, nil
 }
@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+// SaveServiceAccount creates a user with the service role and no password.
+func (s *Storage) SaveServiceAccount(ctx context.Context, name string) (int, error) {
+	const op = "sqlite.storage.SaveServiceAccount"
+	var id int
+	if err := s.db.QueryRowContext(ctx, saveServiceAccountQuery, name, models.RoleService).Scan(&id); err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	const op = "sqlite.storage.SaveAPIKey"
+	var expiresAt sql.NullInt64
+	if key.ExpiresAt != nil {
+		expiresAt = sql.NullInt64{Int64: key.ExpiresAt.UnixNano(), Valid: true}
+	}
+	_, err := s.db.ExecContext(ctx, saveAPIKeyQuery, key.Id, key.ServiceAccount, key.KeyHash,
+		strings.Join(key.Scopes, " "), key.CreatedBy, time.Now().UnixNano(), expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	const op = "sqlite.storage.GetAPIKey"
+	key, err := scanAPIKey(s.db.QueryRowContext(ctx, getAPIKeyQuery, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return key, nil
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context, serviceAccount string) ([]models.APIKey, error) {
+	const op = "sqlite.storage.ListAPIKeys"
+	rows, err := s.db.QueryContext(ctx, listAPIKeysQuery, serviceAccount)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return keys, nil
+}
+
+func (s *Storage) RevokeAPIKey(ctx context.Context, serviceAccount, id string) error {
+	const op = "sqlite.storage.RevokeAPIKey"
+	res, err := s.db.ExecContext(ctx, revokeAPIKeyQuery, id, serviceAccount)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	const op = "sqlite.storage.TouchAPIKey"
+	if _, err := s.db.ExecContext(ctx, touchAPIKeyQuery, id, usedAt.UnixNano()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var createdAt int64
+	var expiresAt, lastUsedAt sql.NullInt64
+	err := row.Scan(&key.Id, &key.ServiceAccount, &key.KeyHash, &scopes, &key.CreatedBy, &createdAt,
+		&expiresAt, &lastUsedAt, &key.Revoked)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.CreatedAt = time.Unix(0, createdAt)
+	if expiresAt.Valid {
+		t := time.Unix(0, expiresAt.Int64)
+		key.ExpiresAt = &t
+	}
+	if lastUsedAt.Valid {
+		t := time.Unix(0, lastUsedAt.Int64)
+		key.LastUsedAt = &t
+	}
+	return &key, nil
+}
@@ -0,0 +1,147 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Storage) GetMerchItem(ctx context.Context, name string) (*models.MerchItem, error) {
+	const op = "sqlite.storage.GetMerchItem"
+	var item models.MerchItem
+	err := s.db.QueryRowContext(ctx, getMerchItemQuery, name).Scan(&item.Id, &item.Name, &item.Price, &item.Description, &item.Available, &item.Stock, &item.PerUserLimit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &item, nil
+}
+
+func (s *Storage) ListMerchItems(ctx context.Context) ([]models.MerchItem, error) {
+	const op = "sqlite.storage.ListMerchItems"
+	items := make([]models.MerchItem, 0)
+	var item models.MerchItem
+	rows, err := s.db.QueryContext(ctx, listMerchItemsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&item.Id, &item.Name, &item.Price, &item.Description, &item.Available, &item.Stock, &item.PerUserLimit); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return items, nil
+}
+
+func (s *Storage) SaveMerchItem(ctx context.Context, item models.MerchItem, actor string) (int, error) {
+	const op = "sqlite.storage.SaveMerchItem"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+	var id int
+	if err := tx.QueryRowContext(ctx, saveMerchItemQuery, item.Name, item.Price, item.Description, item.Stock, item.PerUserLimit).Scan(&id); err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrItemExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := tx.ExecContext(ctx, saveMerchItemPriceQuery, id, item.Price, actor, time.Now().UnixNano()); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// UpdateMerchItem changes the price, description and per-user limit of the
+// item with the given name, and its stock when setStock is true. A new price
+// version is recorded when the price changes.
+func (s *Storage) UpdateMerchItem(ctx context.Context, item models.MerchItem, setStock bool, actor string) error {
+	const op = "sqlite.storage.UpdateMerchItem"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+	var id, price int
+	if err := tx.QueryRowContext(ctx, getMerchItemPriceQuery, item.Name).Scan(&id, &price); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := tx.ExecContext(ctx, updateMerchItemQuery, id, item.Price, item.Description, item.PerUserLimit); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if setStock {
+		if _, err := tx.ExecContext(ctx, setMerchItemStockQuery, id, item.Stock); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if price != item.Price {
+		if _, err := tx.ExecContext(ctx, saveMerchItemPriceQuery, id, item.Price, actor, time.Now().UnixNano()); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) SetMerchItemAvailable(ctx context.Context, name string, available bool) error {
+	const op = "sqlite.storage.SetMerchItemAvailable"
+	res, err := s.db.ExecContext(ctx, setMerchItemAvailableQuery, name, available)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) GetMerchItemPrices(ctx context.Context, name string) ([]models.MerchItemPrice, error) {
+	const op = "sqlite.storage.GetMerchItemPrices"
+	prices := make([]models.MerchItemPrice, 0)
+	var price models.MerchItemPrice
+	var validFrom int64
+	rows, err := s.db.QueryContext(ctx, getMerchItemPricesQuery, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&price.Price, &validFrom, &price.ChangedBy); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		price.ValidFrom = time.Unix(0, validFrom)
+		prices = append(prices, price)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrItemNotFound)
+	}
+	return prices, nil
+}
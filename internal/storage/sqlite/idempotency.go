@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Storage) ReserveIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "sqlite.storage.ReserveIdempotencyKey"
+	res, err := s.db.ExecContext(ctx, reserveKeyQuery, key.Username, key.Key, key.Fingerprint, time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyExists)
+	}
+	return nil
+}
+
+func (s *Storage) GetIdempotencyKey(ctx context.Context, username, key string) (*models.IdempotencyKey, error) {
+	const op = "sqlite.storage.GetIdempotencyKey"
+	var res models.IdempotencyKey
+	var createdAt int64
+	err := s.db.QueryRowContext(ctx, getKeyQuery, username, key).
+		Scan(&res.Username, &res.Key, &res.Fingerprint, &res.StatusCode, &res.Response, &createdAt, &res.Attempt, &res.TransactionId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	res.CreatedAt = time.Unix(0, createdAt)
+	return &res, nil
+}
+
+// SaveIdempotencyResponse completes the reservation key.Attempt of the key.
+func (s *Storage) SaveIdempotencyResponse(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "sqlite.storage.SaveIdempotencyResponse"
+	res, err := s.db.ExecContext(ctx, saveKeyResponseQuery, key.Username, key.Key, key.Attempt, key.StatusCode, key.Response)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return keyAffected(op, res)
+}
+
+// DeleteIdempotencyKey deletes the reservation key.Attempt of the key unless
+// it was completed or a transaction was posted with it.
+func (s *Storage) DeleteIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "sqlite.storage.DeleteIdempotencyKey"
+	res, err := s.db.ExecContext(ctx, deleteKeyQuery, key.Username, key.Key, key.Attempt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return keyAffected(op, res)
+}
+
+// ReclaimIdempotencyKey takes over the reservation key.Attempt of a key that
+// was neither completed nor used to post a transaction.
+func (s *Storage) ReclaimIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error {
+	const op = "sqlite.storage.ReclaimIdempotencyKey"
+	res, err := s.db.ExecContext(ctx, reclaimKeyQuery, key.Username, key.Key, key.Attempt, time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return keyAffected(op, res)
+}
+
+func keyAffected(op string, res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+	return nil
+}
+
+// markIdempotencyKey records that the reservation key posted transactionId.
+// It fails if the reservation was taken over or already used.
+func markIdempotencyKey(ctx context.Context, tx *sql.Tx, key models.IdempotencyKey, transactionId int) error {
+	res, err := tx.ExecContext(ctx, markKeyQuery, key.Username, key.Key, key.Attempt, transactionId)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Storage) SaveUserIdentity(ctx context.Context, identity models.UserIdentity) error {
+	const op = "sqlite.storage.SaveUserIdentity"
+	_, err := s.db.ExecContext(ctx, saveUserIdentityQuery, identity.Issuer, identity.Subject, identity.Username,
+		time.Now().UnixNano())
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrIdentityExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) GetUserIdentity(ctx context.Context, issuer, subject string) (*models.UserIdentity, error) {
+	const op = "sqlite.storage.GetUserIdentity"
+	var identity models.UserIdentity
+	var createdAt int64
+	err := s.db.QueryRowContext(ctx, getUserIdentityQuery, issuer, subject).
+		Scan(&identity.Issuer, &identity.Subject, &identity.Username, &createdAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrIdentityNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	identity.CreatedAt = time.Unix(0, createdAt)
+	return &identity, nil
+}
@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Storage) SavePasswordReset(ctx context.Context, reset models.PasswordReset) error {
+	const op = "sqlite.storage.SavePasswordReset"
+	_, err := s.db.ExecContext(ctx, savePasswordResetQuery, reset.TokenHash, reset.Username, reset.CreatedBy,
+		reset.ExpiresAt.UnixNano(), time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) GetPasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	const op = "sqlite.storage.GetPasswordReset"
+	var reset models.PasswordReset
+	var expiresAt int64
+	err := s.db.QueryRowContext(ctx, getPasswordResetQuery, tokenHash).
+		Scan(&reset.TokenHash, &reset.Username, &reset.CreatedBy, &expiresAt, &reset.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrResetNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	reset.ExpiresAt = time.Unix(0, expiresAt)
+	return &reset, nil
+}
+
+// UsePasswordReset marks an unused, unexpired reset as used. It fails with
+// storage.ErrResetNotFound otherwise, so a token can be redeemed only once.
+func (s *Storage) UsePasswordReset(ctx context.Context, tokenHash string) error {
+	const op = "sqlite.storage.UsePasswordReset"
+	res, err := s.db.ExecContext(ctx, usePasswordResetQuery, tokenHash, time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrResetNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+func (s *Storage) SaveSession(ctx context.Context, session models.Session) error {
+	const op = "sqlite.storage.SaveSession"
+	_, err := s.db.ExecContext(ctx, saveSessionQuery, session.Id, session.Username, session.RefreshHash,
+		session.ExpiresAt.UnixNano(), time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	const op = "sqlite.storage.GetSession"
+	var session models.Session
+	var expiresAt, createdAt int64
+	err := s.db.QueryRowContext(ctx, getSessionQuery, id).
+		Scan(&session.Id, &session.Username, &session.RefreshHash, &expiresAt, &createdAt, &session.Revoked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	session.ExpiresAt = time.Unix(0, expiresAt)
+	session.CreatedAt = time.Unix(0, createdAt)
+	return &session, nil
+}
+
+// RotateSession replaces the refresh token hash of a live session. It fails
+// with storage.ErrSessionNotFound if refreshHash is no longer the current one,
+// so only one of two concurrent refreshes with the same token succeeds.
+func (s *Storage) RotateSession(ctx context.Context, id, refreshHash, newRefreshHash string, expiresAt time.Time) error {
+	const op = "sqlite.storage.RotateSession"
+	res, err := s.db.ExecContext(ctx, rotateSessionQuery, id, refreshHash, newRefreshHash, expiresAt.UnixNano(), time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, id string) error {
+	const op = "sqlite.storage.RevokeSession"
+	res, err := s.db.ExecContext(ctx, revokeSessionQuery, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) RevokeUserSessions(ctx context.Context, username string) error {
+	const op = "sqlite.storage.RevokeUserSessions"
+	if _, err := s.db.ExecContext(ctx, revokeUserSessionsQuery, username); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RevokeToken puts an access token id on the revocation list until the token
+// expires. Entries of already expired tokens are pruned on the way.
+func (s *Storage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	const op = "sqlite.storage.RevokeToken"
+	if _, err := s.db.ExecContext(ctx, pruneRevokedTokensQuery, time.Now().UnixNano()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := s.db.ExecContext(ctx, revokeTokenQuery, jti, expiresAt.UnixNano()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) IsTokenRevoked(ctx context.Context, jti, sessionId string) (bool, error) {
+	const op = "sqlite.storage.IsTokenRevoked"
+	var revoked bool
+	if err := s.db.QueryRowContext(ctx, isTokenRevokedQuery, jti, sessionId).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return revoked, nil
+}
@@ -0,0 +1,188 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+	"github.com/splashk1e/avito-shop/internal/storage/migrate"
+	"github.com/splashk1e/avito-shop/schema"
+	sqlitedriver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Storage is an embedded SQLite backend for single node demos and offline
+// development. Writes are serialized by SQLite itself, every transaction
+// takes the database write lock up front.
+type Storage struct {
+	db *sql.DB
+}
+
+const (
+	saveUserQuery              = "INSERT INTO users(username, pass_hash) VALUES(?1, ?2) RETURNING id"
+	getUserQuery               = "SELECT id, username, pass_hash, coins, role FROM users WHERE username = ?1"
+	getAccountQuery            = "SELECT coins, system FROM users WHERE username = ?1"
+	updateBalanceQuery         = "UPDATE users SET coins = coins + ?2 WHERE username = ?1 RETURNING coins"
+	saveTransactionQuery       = "INSERT INTO transactions(sender, receiver, amount, item, quantity, created_at, actor, reason) VALUES(?1, ?2, ?3, NULLIF(?4, ''), ?5, ?6, NULLIF(?7, ''), NULLIF(?8, '')) RETURNING id"
+	saveLedgerEntryQuery       = "INSERT INTO ledger_entries(transaction_id, username, amount) VALUES(?1, ?2, ?3)"
+	getInventoryQuery          = "SELECT item, SUM(quantity) FROM transactions WHERE sender = ?1 AND item IS NOT NULL GROUP BY item ORDER BY item"
+	getCoinHistoryQuery        = "SELECT 'sent', receiver, SUM(amount) FROM transactions WHERE sender = ?1 AND item IS NULL GROUP BY receiver UNION ALL SELECT 'received', sender, SUM(amount) FROM transactions WHERE receiver = ?1 AND item IS NULL GROUP BY sender ORDER BY 2"
+	getMerchItemQuery          = "SELECT id, name, price, description, available, stock, per_user_limit FROM merch_items WHERE name = ?1"
+	listMerchItemsQuery        = "SELECT id, name, price, description, available, stock, per_user_limit FROM merch_items ORDER BY name"
+	reserveKeyQuery            = "INSERT INTO idempotency_keys(username, key, fingerprint, created_at) VALUES(?1, ?2, ?3, ?4) ON CONFLICT DO NOTHING"
+	getKeyQuery                = "SELECT username, key, fingerprint, COALESCE(status_code, 0), response, created_at, attempt, COALESCE(transaction_id, 0) FROM idempotency_keys WHERE username = ?1 AND key = ?2"
+	saveKeyResponseQuery       = "UPDATE idempotency_keys SET status_code = ?4, response = ?5 WHERE username = ?1 AND key = ?2 AND attempt = ?3 AND status_code IS NULL"
+	deleteKeyQuery             = "DELETE FROM idempotency_keys WHERE username = ?1 AND key = ?2 AND attempt = ?3 AND status_code IS NULL AND transaction_id IS NULL"
+	reclaimKeyQuery            = "UPDATE idempotency_keys SET attempt = attempt + 1, created_at = ?4 WHERE username = ?1 AND key = ?2 AND attempt = ?3 AND status_code IS NULL AND transaction_id IS NULL"
+	markKeyQuery               = "UPDATE idempotency_keys SET transaction_id = ?4 WHERE username = ?1 AND key = ?2 AND attempt = ?3 AND status_code IS NULL AND transaction_id IS NULL"
+	setUserRoleQuery           = "UPDATE users SET role = ?2 WHERE username = ?1 AND NOT system"
+	saveMerchItemQuery         = "INSERT INTO merch_items(name, price, description, stock, per_user_limit) VALUES(?1, ?2, ?3, ?4, ?5) RETURNING id"
+	getMerchItemPriceQuery     = "SELECT id, price FROM merch_items WHERE name = ?1"
+	updateMerchItemQuery       = "UPDATE merch_items SET price = ?2, description = ?3, per_user_limit = ?4 WHERE id = ?1"
+	setMerchItemAvailableQuery = "UPDATE merch_items SET available = ?2 WHERE name = ?1"
+	saveMerchItemPriceQuery    = "INSERT INTO merch_item_prices(item_id, price, changed_by, valid_from) VALUES(?1, ?2, NULLIF(?3, ''), ?4)"
+	getMerchItemPricesQuery    = "SELECT p.price, p.valid_from, COALESCE(p.changed_by, '') FROM merch_item_prices p JOIN merch_items i ON i.id = p.item_id WHERE i.name = ?1 ORDER BY p.valid_from DESC, p.id DESC"
+	getPurchaseItemQuery       = "SELECT available, price, stock, per_user_limit FROM merch_items WHERE name = ?1"
+	countPurchasedQuery        = "SELECT COALESCE(SUM(quantity), 0) FROM transactions WHERE sender = ?1 AND item = ?2"
+	takeStockQuery             = "UPDATE merch_items SET stock = stock - ?2 WHERE name = ?1 AND stock IS NOT NULL"
+	setMerchItemStockQuery     = "UPDATE merch_items SET stock = ?2 WHERE id = ?1"
+	saveSessionQuery           = "INSERT INTO sessions(id, username, refresh_hash, expires_at, created_at) VALUES(?1, ?2, ?3, ?4, ?5)"
+	getSessionQuery            = "SELECT id, username, refresh_hash, expires_at, created_at, revoked FROM sessions WHERE id = ?1"
+	rotateSessionQuery         = "UPDATE sessions SET refresh_hash = ?3, expires_at = ?4 WHERE id = ?1 AND refresh_hash = ?2 AND NOT revoked AND expires_at > ?5"
+	revokeSessionQuery         = "UPDATE sessions SET revoked = 1 WHERE id = ?1"
+	revokeTokenQuery           = "INSERT INTO revoked_tokens(jti, expires_at) VALUES(?1, ?2) ON CONFLICT DO NOTHING"
+	pruneRevokedTokensQuery    = "DELETE FROM revoked_tokens WHERE expires_at < ?1"
+	isTokenRevokedQuery        = "SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = ?1) OR EXISTS(SELECT 1 FROM sessions WHERE id = ?2 AND revoked)"
+	setUserPasswordQuery       = "UPDATE users SET pass_hash = ?2 WHERE username = ?1 AND NOT system"
+	revokeUserSessionsQuery    = "UPDATE sessions SET revoked = 1 WHERE username = ?1 AND NOT revoked"
+	savePasswordResetQuery     = "INSERT INTO password_resets(token_hash, username, created_by, expires_at, created_at) VALUES(?1, ?2, NULLIF(?3, ''), ?4, ?5)"
+	getPasswordResetQuery      = "SELECT token_hash, username, COALESCE(created_by, ''), expires_at, used FROM password_resets WHERE token_hash = ?1"
+	usePasswordResetQuery      = "UPDATE password_resets SET used = 1 WHERE token_hash = ?1 AND NOT used AND expires_at > ?2"
+	saveUserIdentityQuery      = "INSERT INTO user_identities(issuer, subject, username, created_at) VALUES(?1, ?2, ?3, ?4)"
+	getUserIdentityQuery       = "SELECT issuer, subject, username, created_at FROM user_identities WHERE issuer = ?1 AND subject = ?2"
+	saveServiceAccountQuery    = "INSERT INTO users(username, pass_hash, role) VALUES(?1, '', ?2) RETURNING id"
+	saveAPIKeyQuery            = "INSERT INTO api_keys(id, service_account, key_hash, scopes, created_by, created_at, expires_at) VALUES(?1, ?2, ?3, ?4, NULLIF(?5, ''), ?6, ?7)"
+	getAPIKeyQuery             = "SELECT id, service_account, key_hash, scopes, COALESCE(created_by, ''), created_at, expires_at, last_used_at, revoked FROM api_keys WHERE id = ?1"
+	listAPIKeysQuery           = "SELECT id, service_account, key_hash, scopes, COALESCE(created_by, ''), created_at, expires_at, last_used_at, revoked FROM api_keys WHERE service_account = ?1 ORDER BY created_at, id"
+	revokeAPIKeyQuery          = "UPDATE api_keys SET revoked = 1 WHERE id = ?1 AND service_account = ?2"
+	touchAPIKeyQuery           = "UPDATE api_keys SET last_used_at = ?2 WHERE id = ?1"
+)
+
+func New(storagePath string) *Storage {
+	db, err := sql.Open("sqlite", dsn(storagePath))
+	if err != nil {
+		panic("can't open sqlite database with error:" + err.Error())
+	}
+	// a single connection keeps transactions serialized and lets ":memory:" work
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		panic("can't open sqlite database with error:" + err.Error())
+	}
+	return &Storage{
+		db: db,
+	}
+}
+
+func (s *Storage) SetUserRole(ctx context.Context, username, role string) error {
+	const op = "sqlite.storage.SetUserRole"
+	res, err := s.db.ExecContext(ctx, setUserRoleQuery, username, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) SetUserPassword(ctx context.Context, username string, passHash []byte) error {
+	const op = "sqlite.storage.SetUserPassword"
+	res, err := s.db.ExecContext(ctx, setUserPasswordQuery, username, passHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) Migrator() *migrate.Migrator {
+	return migrate.New(s.db, schema.SQLite, func(n int) string {
+		return "?" + strconv.Itoa(n)
+	})
+}
+
+func dsn(storagePath string) string {
+	params := "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+	if strings.Contains(storagePath, "?") {
+		return storagePath + "&" + params
+	}
+	return storagePath + "?" + params
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlitedriver.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+}
+
+// SaveUser creates a user and grants welcomeGrant coins from the bank in the
+// same database transaction, so no user is left without the grant.
+func (s *Storage) SaveUser(ctx context.Context, username string, passHash []byte, welcomeGrant int) (int, error) {
+	const op = "sqlite.storage.SaveUser"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRowContext(ctx, saveUserQuery, username, string(passHash)).Scan(&id); err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if welcomeGrant > 0 {
+		grant := models.Transaction{
+			Sender:   storage.BankAccount,
+			Reciever: username,
+			Amount:   welcomeGrant,
+			Quantity: 1,
+		}
+		if _, _, err := insertTransaction(ctx, tx, grant); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) GetUser(ctx context.Context, username string) (*models.User, error) {
+	const op = "sqlite.storage.GetUser"
+	var user models.User
+	err := s.db.QueryRowContext(ctx, getUserQuery, username).Scan(&user.Id, &user.Username, &user.PassHash, &user.Coins, &user.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &user, nil
+}
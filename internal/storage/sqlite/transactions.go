@@ -0,0 +1,257 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/splashk1e/avito-shop/internal/models"
+	"github.com/splashk1e/avito-shop/internal/storage"
+)
+
+type account struct {
+	coins  int
+	system bool
+}
+
+// SaveTransaction moves transaction.Amount coins from the sender to the receiver
+// and writes a debit and a credit ledger entry in one database transaction. It
+// returns the transaction id and the sender balance the transaction left.
+func (s *Storage) SaveTransaction(ctx context.Context, transaction models.Transaction) (int, int, error) {
+	const op = "sqlite.storage.SaveTransaction"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	sender, err := getAccount(ctx, tx, transaction.Sender)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := getAccount(ctx, tx, transaction.Reciever); err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if !sender.system && sender.coins < transaction.Amount {
+		return 0, 0, fmt.Errorf("%s: %w", op, storage.ErrNoCoins)
+	}
+	if transaction.Item != "" {
+		if err := takeStock(ctx, tx, transaction); err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	id, balance, err := insertTransaction(ctx, tx, transaction)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if transaction.IdempotencyKey != nil {
+		if err := markIdempotencyKey(ctx, tx, *transaction.IdempotencyKey, id); err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, balance, nil
+}
+
+// insertTransaction writes transaction with its debit and credit ledger
+// entries and updates both balances, the caller checks the sender balance.
+// It returns the transaction id and the new sender balance.
+func insertTransaction(ctx context.Context, tx *sql.Tx, transaction models.Transaction) (int, int, error) {
+	var id int
+	err := tx.QueryRowContext(ctx, saveTransactionQuery, transaction.Sender, transaction.Reciever, transaction.Amount,
+		transaction.Item, transaction.Quantity, time.Now().UnixNano(), transaction.Actor, transaction.Reason).Scan(&id)
+	if err != nil {
+		return 0, 0, err
+	}
+	balance, err := postEntry(ctx, tx, id, transaction.Sender, -transaction.Amount)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := postEntry(ctx, tx, id, transaction.Reciever, transaction.Amount); err != nil {
+		return 0, 0, err
+	}
+	return id, balance, nil
+}
+
+func getAccount(ctx context.Context, tx *sql.Tx, username string) (*account, error) {
+	var acc account
+	if err := tx.QueryRowContext(ctx, getAccountQuery, username).Scan(&acc.coins, &acc.system); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &acc, nil
+}
+
+// takeStock checks that the purchased item is still available at the price
+// the amount was computed with, checks its stock and per-user limit and takes
+// the bought quantity out of stock. Transactions are opened with
+// BEGIN IMMEDIATE, so no other purchase can interleave.
+func takeStock(ctx context.Context, tx *sql.Tx, transaction models.Transaction) error {
+	var available bool
+	var price int
+	var stock, limit *int
+	if err := tx.QueryRowContext(ctx, getPurchaseItemQuery, transaction.Item).Scan(&available, &price, &stock, &limit); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrItemNotFound
+		}
+		return err
+	}
+	if !available {
+		return storage.ErrItemRetired
+	}
+	if price*transaction.Quantity != transaction.Amount {
+		return storage.ErrPriceChanged
+	}
+	if stock != nil && *stock < transaction.Quantity {
+		return storage.ErrSoldOut
+	}
+	if limit != nil {
+		var purchased int
+		if err := tx.QueryRowContext(ctx, countPurchasedQuery, transaction.Sender, transaction.Item).Scan(&purchased); err != nil {
+			return err
+		}
+		if purchased+transaction.Quantity > *limit {
+			return storage.ErrLimitReached
+		}
+	}
+	if stock != nil {
+		if _, err := tx.ExecContext(ctx, takeStockQuery, transaction.Item, transaction.Quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postEntry writes a ledger entry and returns the balance it left.
+func postEntry(ctx context.Context, tx *sql.Tx, transactionId int, username string, amount int) (int, error) {
+	if _, err := tx.ExecContext(ctx, saveLedgerEntryQuery, transactionId, username, amount); err != nil {
+		return 0, err
+	}
+	var balance int
+	if err := tx.QueryRowContext(ctx, updateBalanceQuery, username, amount).Scan(&balance); err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+func (s *Storage) ListTransactions(ctx context.Context, filter models.TransactionFilter) ([]models.Transaction, error) {
+	const op = "sqlite.storage.ListTransactions"
+	query, args := listTransactionsQuery(filter)
+	transactions := make([]models.Transaction, 0, filter.Limit)
+	var transaction models.Transaction
+	var createdAt int64
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&transaction.Id, &transaction.Sender, &transaction.Reciever, &transaction.Amount,
+			&transaction.Item, &transaction.Quantity, &createdAt, &transaction.Actor, &transaction.Reason); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		transaction.CreatedAt = time.Unix(0, createdAt)
+		transactions = append(transactions, transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return transactions, nil
+}
+
+func listTransactionsQuery(filter models.TransactionFilter) (string, []any) {
+	var query strings.Builder
+	args := []any{filter.Username}
+	arg := func(value any) string {
+		args = append(args, value)
+		return "?" + strconv.Itoa(len(args))
+	}
+	query.WriteString("SELECT id, sender, receiver, amount, COALESCE(item, ''), quantity, created_at, COALESCE(actor, ''), COALESCE(reason, '') FROM transactions WHERE ")
+	switch filter.Direction {
+	case models.DirectionSent:
+		query.WriteString("sender = ?1 AND item IS NULL")
+	case models.DirectionReceived:
+		query.WriteString("receiver = ?1 AND item IS NULL")
+	case models.DirectionPurchase:
+		query.WriteString("sender = ?1 AND item IS NOT NULL")
+	default:
+		query.WriteString("(sender = ?1 OR receiver = ?1)")
+	}
+	if filter.Counterparty != "" {
+		p := arg(filter.Counterparty)
+		query.WriteString(" AND ((sender = ?1 AND receiver = " + p + ") OR (receiver = ?1 AND sender = " + p + "))")
+	}
+	if filter.Item != "" {
+		query.WriteString(" AND item = " + arg(filter.Item))
+	}
+	if !filter.From.IsZero() {
+		query.WriteString(" AND created_at >= " + arg(filter.From.UnixNano()))
+	}
+	if !filter.To.IsZero() {
+		query.WriteString(" AND created_at < " + arg(filter.To.UnixNano()))
+	}
+	if filter.After != nil {
+		query.WriteString(" AND (created_at, id) < (" + arg(filter.After.CreatedAt.UnixNano()) + ", " + arg(filter.After.Id) + ")")
+	}
+	query.WriteString(" ORDER BY created_at DESC, id DESC LIMIT " + arg(filter.Limit))
+	return query.String(), args
+}
+
+func (s *Storage) GetInventory(ctx context.Context, username string) ([]models.InventoryItem, error) {
+	const op = "sqlite.storage.GetInventory"
+	inventory := make([]models.InventoryItem, 0)
+	var item models.InventoryItem
+	rows, err := s.db.QueryContext(ctx, getInventoryQuery, username)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&item.Type, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		inventory = append(inventory, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return inventory, nil
+}
+
+func (s *Storage) GetCoinHistory(ctx context.Context, username string) (*models.CoinHistory, error) {
+	const op = "sqlite.storage.GetCoinHistory"
+	history := models.CoinHistory{
+		Received: make([]models.CoinTransfer, 0),
+		Sent:     make([]models.CoinTransfer, 0),
+	}
+	rows, err := s.db.QueryContext(ctx, getCoinHistoryQuery, username)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var direction string
+		var transfer models.CoinTransfer
+		if err := rows.Scan(&direction, &transfer.User, &transfer.Amount); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if direction == "sent" {
+			history.Sent = append(history.Sent, transfer)
+		} else {
+			history.Received = append(history.Received, transfer)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &history, nil
+}
@@ -1,9 +1,39 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"strings"
+)
 
 var (
-	ErrUserExists   = errors.New("user already exists")
-	ErrUserNotFound = errors.New("user not found")
-	ErrNoCoins      = errors.New("user have not enough coins")
+	ErrUserExists       = errors.New("user already exists")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrNoCoins          = errors.New("user have not enough coins")
+	ErrItemNotFound     = errors.New("item not found")
+	ErrItemExists       = errors.New("item already exists")
+	ErrSoldOut          = errors.New("item is sold out")
+	ErrLimitReached     = errors.New("item purchase limit reached")
+	ErrItemRetired      = errors.New("item is retired")
+	ErrPriceChanged     = errors.New("item price changed")
+	ErrKeyExists        = errors.New("idempotency key already exists")
+	ErrKeyNotFound      = errors.New("idempotency key not found")
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrResetNotFound    = errors.New("password reset not found")
+	ErrIdentityExists   = errors.New("identity already linked")
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrAPIKeyNotFound   = errors.New("api key not found")
+)
+
+const (
+	// ShopAccount is the system account that receives coins for merch purchases.
+	ShopAccount = "@shop"
+	// BankAccount is the system account that issues coins, its balance is
+	// minus the coins in circulation. Like every system account it may go
+	// below zero, the shop never does since it only receives coins.
+	BankAccount = "@bank"
 )
+
+// IsSystemAccount reports whether username is reserved for a system account.
+func IsSystemAccount(username string) bool {
+	return strings.HasPrefix(username, "@")
+}
@@ -0,0 +1 @@
+DROP TABLE merch_items;
@@ -0,0 +1,3 @@
+ALTER TABLE merch_items
+    DROP COLUMN description,
+    DROP COLUMN available;
@@ -0,0 +1,16 @@
+ALTER TABLE merch_items
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN available BOOLEAN NOT NULL DEFAULT TRUE;
+UPDATE merch_items SET description = CASE name
+    WHEN 't-shirt' THEN 'Avito t-shirt'
+    WHEN 'cup' THEN 'Mug with the Avito logo'
+    WHEN 'book' THEN 'Notebook'
+    WHEN 'pen' THEN 'Ballpoint pen'
+    WHEN 'powerbank' THEN 'Portable charger'
+    WHEN 'hoody' THEN 'Avito hoody'
+    WHEN 'umbrella' THEN 'Umbrella'
+    WHEN 'socks' THEN 'Pair of socks'
+    WHEN 'wallet' THEN 'Leather wallet'
+    WHEN 'pink-hoody' THEN 'Limited pink hoody'
+    ELSE description
+END;
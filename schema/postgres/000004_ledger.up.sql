@@ -0,0 +1,16 @@
+ALTER TABLE users
+    ALTER COLUMN coins SET NOT NULL,
+    ADD COLUMN system BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD CONSTRAINT users_coins_non_negative CHECK (system OR coins >= 0);
+INSERT INTO users (username, pass_hash, coins, system) VALUES ('@shop', '', 0, TRUE);
+ALTER TABLE transactions ADD CONSTRAINT transactions_amount_positive CHECK (amount > 0);
+CREATE TABLE ledger_entries (
+    id SERIAL PRIMARY KEY,
+    transaction_id INT NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    amount INT NOT NULL CHECK (amount <> 0),
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id),
+    FOREIGN KEY (username) REFERENCES users(username)
+);
+CREATE INDEX idx_ledger_entries_transaction_id ON ledger_entries(transaction_id);
+CREATE INDEX idx_ledger_entries_username ON ledger_entries(username);
@@ -0,0 +1 @@
+INSERT INTO users (username, pass_hash, coins, system) VALUES ('@bank', '', 0, TRUE);
@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_keys (
+    username VARCHAR(255) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    status_code INT,
+    response BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (username, key),
+    FOREIGN KEY (username) REFERENCES users(username)
+);
@@ -0,0 +1 @@
+ALTER TABLE transactions ADD COLUMN quantity INT NOT NULL DEFAULT 1 CHECK (quantity > 0);
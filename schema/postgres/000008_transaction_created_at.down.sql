@@ -0,0 +1,3 @@
+DROP INDEX idx_transactions_receiver_created_at;
+DROP INDEX idx_transactions_sender_created_at;
+ALTER TABLE transactions DROP COLUMN created_at;
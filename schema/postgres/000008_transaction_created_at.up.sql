@@ -0,0 +1,3 @@
+ALTER TABLE transactions ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+CREATE INDEX idx_transactions_sender_created_at ON transactions(sender, created_at DESC, id DESC);
+CREATE INDEX idx_transactions_receiver_created_at ON transactions(receiver, created_at DESC, id DESC);
@@ -0,0 +1,4 @@
+ALTER TABLE transactions
+    DROP COLUMN reason,
+    DROP COLUMN actor;
+ALTER TABLE users DROP COLUMN role;
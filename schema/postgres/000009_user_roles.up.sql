@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'user';
+ALTER TABLE transactions
+    ADD COLUMN actor VARCHAR(255) REFERENCES users(username),
+    ADD COLUMN reason TEXT;
@@ -0,0 +1,11 @@
+CREATE TABLE merch_item_prices (
+    id SERIAL PRIMARY KEY,
+    item_id INT NOT NULL,
+    price INT NOT NULL CHECK (price > 0),
+    valid_from TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    changed_by VARCHAR(255),
+    FOREIGN KEY (item_id) REFERENCES merch_items(id),
+    FOREIGN KEY (changed_by) REFERENCES users(username)
+);
+CREATE INDEX idx_merch_item_prices_item_id ON merch_item_prices(item_id, valid_from DESC);
+INSERT INTO merch_item_prices (item_id, price) SELECT id, price FROM merch_items;
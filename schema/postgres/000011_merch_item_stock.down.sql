@@ -0,0 +1,3 @@
+ALTER TABLE merch_items
+    DROP COLUMN per_user_limit,
+    DROP COLUMN stock;
@@ -0,0 +1,3 @@
+ALTER TABLE merch_items
+    ADD COLUMN stock INT CHECK (stock >= 0),
+    ADD COLUMN per_user_limit INT CHECK (per_user_limit > 0);
@@ -0,0 +1,14 @@
+CREATE TABLE sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    refresh_hash VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (username) REFERENCES users(username)
+);
+CREATE INDEX idx_sessions_username ON sessions(username);
+CREATE TABLE revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
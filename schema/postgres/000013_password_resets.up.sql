@@ -0,0 +1,10 @@
+CREATE TABLE password_resets (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    created_by VARCHAR(255),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (username) REFERENCES users(username),
+    FOREIGN KEY (created_by) REFERENCES users(username)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE user_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (issuer, subject),
+    FOREIGN KEY (username) REFERENCES users(username)
+);
+CREATE INDEX idx_user_identities_username ON user_identities(username);
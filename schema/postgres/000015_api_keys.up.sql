@@ -0,0 +1,14 @@
+CREATE TABLE api_keys (
+    id VARCHAR(32) PRIMARY KEY,
+    service_account VARCHAR(255) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL,
+    scopes TEXT NOT NULL,
+    created_by VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (service_account) REFERENCES users(username),
+    FOREIGN KEY (created_by) REFERENCES users(username)
+);
+CREATE INDEX idx_api_keys_service_account ON api_keys(service_account);
@@ -0,0 +1,3 @@
+ALTER TABLE idempotency_keys
+    DROP COLUMN transaction_id,
+    DROP COLUMN attempt;
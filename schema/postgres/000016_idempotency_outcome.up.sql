@@ -0,0 +1,3 @@
+ALTER TABLE idempotency_keys
+    ADD COLUMN attempt INT NOT NULL DEFAULT 1,
+    ADD COLUMN transaction_id INT REFERENCES transactions(id);
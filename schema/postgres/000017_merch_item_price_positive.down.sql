@@ -0,0 +1,3 @@
+ALTER TABLE merch_items
+    DROP CONSTRAINT merch_items_price_check,
+    ADD CONSTRAINT merch_items_price_check CHECK (price >= 0);
@@ -0,0 +1,32 @@
+// Package schema embeds the versioned database migrations of every SQL
+// storage driver. Files are named <version>_<name>.up.sql and
+// <version>_<name>.down.sql. Migrations without a down script can't be
+// rolled back, like postgres 000004_ledger and 000005_bank_account: purchases
+// and grants reference the system accounts they create and have no form
+// without them.
+package schema
+
+import (
+	"embed"
+	"io/fs"
+)
+
+var (
+	//go:embed postgres/*.sql
+	postgresFS embed.FS
+	//go:embed sqlite/*.sql
+	sqliteFS embed.FS
+)
+
+var (
+	Postgres = mustSub(postgresFS, "postgres")
+	SQLite   = mustSub(sqliteFS, "sqlite")
+)
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic("can't open embedded migrations " + dir + ": " + err.Error())
+	}
+	return sub
+}
@@ -0,0 +1,5 @@
+DROP TABLE idempotency_keys;
+DROP TABLE merch_items;
+DROP TABLE ledger_entries;
+DROP TABLE transactions;
+DROP TABLE users;
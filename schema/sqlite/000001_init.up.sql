@@ -0,0 +1,57 @@
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT UNIQUE NOT NULL,
+    pass_hash TEXT NOT NULL,
+    coins INTEGER NOT NULL DEFAULT 0,
+    system INTEGER NOT NULL DEFAULT 0,
+    CHECK (system OR coins >= 0)
+);
+CREATE TABLE transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sender TEXT NOT NULL REFERENCES users(username),
+    receiver TEXT NOT NULL REFERENCES users(username),
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    item TEXT,
+    quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX idx_transactions_sender_created_at ON transactions(sender, created_at DESC, id DESC);
+CREATE INDEX idx_transactions_receiver_created_at ON transactions(receiver, created_at DESC, id DESC);
+CREATE TABLE ledger_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id INTEGER NOT NULL REFERENCES transactions(id),
+    username TEXT NOT NULL REFERENCES users(username),
+    amount INTEGER NOT NULL CHECK (amount <> 0)
+);
+CREATE INDEX idx_ledger_entries_transaction_id ON ledger_entries(transaction_id);
+CREATE INDEX idx_ledger_entries_username ON ledger_entries(username);
+CREATE TABLE merch_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    price INTEGER NOT NULL CHECK (price >= 0),
+    description TEXT NOT NULL DEFAULT '',
+    available INTEGER NOT NULL DEFAULT 1
+);
+CREATE TABLE idempotency_keys (
+    username TEXT NOT NULL REFERENCES users(username),
+    key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    status_code INTEGER,
+    response BLOB,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (username, key)
+);
+INSERT INTO users (username, pass_hash, coins, system) VALUES
+    ('@shop', '', 0, 1),
+    ('@bank', '', 0, 1);
+INSERT INTO merch_items (name, price, description) VALUES
+    ('t-shirt', 80, 'Avito t-shirt'),
+    ('cup', 20, 'Mug with the Avito logo'),
+    ('book', 50, 'Notebook'),
+    ('pen', 10, 'Ballpoint pen'),
+    ('powerbank', 200, 'Portable charger'),
+    ('hoody', 300, 'Avito hoody'),
+    ('umbrella', 200, 'Umbrella'),
+    ('socks', 10, 'Pair of socks'),
+    ('wallet', 50, 'Leather wallet'),
+    ('pink-hoody', 500, 'Limited pink hoody');
@@ -0,0 +1,3 @@
+ALTER TABLE transactions DROP COLUMN reason;
+ALTER TABLE transactions DROP COLUMN actor;
+ALTER TABLE users DROP COLUMN role;
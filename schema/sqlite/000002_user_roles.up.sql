@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE transactions ADD COLUMN actor TEXT REFERENCES users(username);
+ALTER TABLE transactions ADD COLUMN reason TEXT;
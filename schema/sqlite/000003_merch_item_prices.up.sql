@@ -0,0 +1,10 @@
+CREATE TABLE merch_item_prices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    item_id INTEGER NOT NULL REFERENCES merch_items(id),
+    price INTEGER NOT NULL CHECK (price > 0),
+    valid_from INTEGER NOT NULL,
+    changed_by TEXT REFERENCES users(username)
+);
+CREATE INDEX idx_merch_item_prices_item_id ON merch_item_prices(item_id, valid_from DESC);
+INSERT INTO merch_item_prices (item_id, price, valid_from)
+    SELECT id, price, CAST(strftime('%s', 'now') AS INTEGER) * 1000000000 FROM merch_items;
@@ -0,0 +1,2 @@
+ALTER TABLE merch_items DROP COLUMN per_user_limit;
+ALTER TABLE merch_items DROP COLUMN stock;
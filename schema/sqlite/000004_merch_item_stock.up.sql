@@ -0,0 +1,2 @@
+ALTER TABLE merch_items ADD COLUMN stock INTEGER CHECK (stock >= 0);
+ALTER TABLE merch_items ADD COLUMN per_user_limit INTEGER CHECK (per_user_limit > 0);
@@ -0,0 +1,8 @@
+CREATE TABLE password_resets (
+    token_hash TEXT PRIMARY KEY,
+    username TEXT NOT NULL REFERENCES users(username),
+    created_by TEXT REFERENCES users(username),
+    expires_at INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    used INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,12 @@
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY,
+    service_account TEXT NOT NULL REFERENCES users(username),
+    key_hash TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    created_by TEXT REFERENCES users(username),
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER,
+    last_used_at INTEGER,
+    revoked INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX idx_api_keys_service_account ON api_keys(service_account);
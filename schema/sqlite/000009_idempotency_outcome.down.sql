@@ -0,0 +1,2 @@
+ALTER TABLE idempotency_keys DROP COLUMN transaction_id;
+ALTER TABLE idempotency_keys DROP COLUMN attempt;
@@ -0,0 +1,2 @@
+ALTER TABLE idempotency_keys ADD COLUMN attempt INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE idempotency_keys ADD COLUMN transaction_id INTEGER REFERENCES transactions(id);
@@ -0,0 +1,2 @@
+DROP TRIGGER merch_items_price_positive_update;
+DROP TRIGGER merch_items_price_positive_insert;
@@ -0,0 +1,11 @@
+-- SQLite can't change the CHECK of a column without rebuilding the table.
+CREATE TRIGGER merch_items_price_positive_insert BEFORE INSERT ON merch_items
+    WHEN NEW.price <= 0
+BEGIN
+    SELECT RAISE(ABORT, 'CHECK constraint failed: price > 0');
+END;
+CREATE TRIGGER merch_items_price_positive_update BEFORE UPDATE OF price ON merch_items
+    WHEN NEW.price <= 0
+BEGIN
+    SELECT RAISE(ABORT, 'CHECK constraint failed: price > 0');
+END;